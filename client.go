@@ -20,8 +20,10 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/net/context"
 
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
@@ -44,6 +46,65 @@ type Client struct {
 	Http            http.Client
 	websocketDialer websocket.Dialer
 	simplestreams   *simplestreams.SimpleStreams
+	log             logger.Logger
+
+	// Project the requests are scoped to, the default one when empty
+	project string
+}
+
+// UseProject returns a copy of the client whose API requests are scoped to
+// the project, leaving the client itself untouched. Local copies through the
+// scoped client of the destination take the source from the project of the
+// source client.
+func (c *Client) UseProject(project string) *Client {
+	scoped := *c
+	scoped.project = project
+	return &scoped
+}
+
+// projectURL adds the project of the client to the URL of a request
+func (c *Client) projectURL(base string) string {
+	if c.project == "" {
+		return base
+	}
+
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+
+	return base + separator + "project=" + url.QueryEscape(c.project)
+}
+
+// SetLogger makes the client log the requests it does, the websockets it
+// connects to and the operations it waits for to l, at the debug level.
+// Secrets are never logged.
+func (c *Client) SetLogger(l logger.Logger) {
+	c.log = l
+}
+
+func (c *Client) logDebug(msg string, ctx ...interface{}) {
+	if c.log == nil {
+		return
+	}
+
+	c.log.Debug(msg, ctx...)
+}
+
+// redactSecrets returns a copy of the metadata of an operation with the
+// values of its websocket secrets hidden.
+func redactSecrets(metadata map[string]interface{}) map[string]interface{} {
+	redacted := map[string]interface{}{}
+	for k, v := range metadata {
+		switch k {
+		case "control", "fs", "criu":
+			redacted[k] = "<redacted>"
+		default:
+			redacted[k] = v
+		}
+	}
+
+	return redacted
 }
 
 var (
@@ -54,6 +115,7 @@ var (
 	// whatever static error message we would put here.
 	LXDErrors = map[int]error{
 		http.StatusNotFound: fmt.Errorf("not found"),
+		http.StatusConflict: fmt.Errorf("already exists"),
 	}
 )
 
@@ -108,13 +170,25 @@ func HoistResponse(r *http.Response, rtype api.ResponseType) (*api.Response, err
 
 // NewClient returns a new LXD client.
 func NewClient(config *Config, remote string) (*Client, error) {
+	return NewClientWithCert(config, remote, "", "")
+}
+
+// NewClientWithCert returns a new LXD client authenticating with the given
+// PEM encoded client certificate and key instead of the ones stored in the
+// configuration directory. Empty ones behave like NewClient.
+func NewClientWithCert(config *Config, remote string, clientCert string, clientKey string) (*Client, error) {
 	if remote == "" {
 		return nil, fmt.Errorf("A remote name must be provided.")
 	}
 
 	r, ok := config.Remotes[remote]
 	if !ok {
-		return nil, fmt.Errorf("unknown remote name: %q", remote)
+		// Unix sockets can also be used without defining a remote
+		if !strings.HasPrefix(remote, "unix://") {
+			return nil, fmt.Errorf("unknown remote name: %q", remote)
+		}
+
+		r = RemoteConfig{Addr: remote}
 	}
 	info := ConnectInfo{
 		Name:         remote,
@@ -129,7 +203,9 @@ func NewClient(config *Config, remote string) (*Client, error) {
 	} else {
 		// Read the client certificate (if it exists)
 		clientCertPath := path.Join(config.ConfigDir, "client.crt")
-		if shared.PathExists(clientCertPath) {
+		if clientCert != "" {
+			info.ClientPEMCert = clientCert
+		} else if shared.PathExists(clientCertPath) {
 			certBytes, err := ioutil.ReadFile(clientCertPath)
 			if err != nil {
 				return nil, err
@@ -140,7 +216,9 @@ func NewClient(config *Config, remote string) (*Client, error) {
 
 		// Read the client key (if it exists)
 		clientKeyPath := path.Join(config.ConfigDir, "client.key")
-		if shared.PathExists(clientKeyPath) {
+		if clientKey != "" {
+			info.ClientPEMKey = clientKey
+		} else if shared.PathExists(clientKeyPath) {
 			keyBytes, err := ioutil.ReadFile(clientKeyPath)
 			if err != nil {
 				return nil, err
@@ -319,6 +397,10 @@ func NewClientFromInfo(info ConnectInfo) (*Client, error) {
 	return c, nil
 }
 
+// errNoAddresses is returned when a remote can't be reached over the network,
+// which is the case of a local daemon without core.https_address.
+var errNoAddresses = fmt.Errorf("The source remote has no reachable address for migration, set core.https_address on it")
+
 func (c *Client) Addresses() ([]string, error) {
 	addresses := make([]string, 0)
 
@@ -345,36 +427,45 @@ func (c *Client) Addresses() ([]string, error) {
 	}
 
 	if len(addresses) == 0 {
-		return nil, fmt.Errorf("The source remote isn't available over the network")
+		return nil, errNoAddresses
 	}
 
 	return addresses, nil
 }
 
 func (c *Client) get(base string) (*api.Response, error) {
-	uri := c.url(version.APIVersion, base)
+	uri := c.url(version.APIVersion, c.projectURL(base))
 
 	return c.baseGet(uri)
 }
 
 func (c *Client) baseGet(getUrl string) (*api.Response, error) {
+	return c.baseGetContext(context.Background(), getUrl)
+}
+
+// baseGetContext is baseGet with the request aborted when ctx is done
+func (c *Client) baseGetContext(ctx context.Context, getUrl string) (*api.Response, error) {
 	req, err := http.NewRequest("GET", getUrl, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("User-Agent", version.UserAgent)
+	req.Cancel = ctx.Done()
 
 	resp, err := c.Http.Do(req)
 	if err != nil {
+		c.logDebug("Request failed", "method", "GET", "url", getUrl, "err", err)
 		return nil, err
 	}
 
+	c.logDebug("Request", "method", "GET", "url", getUrl, "status", resp.StatusCode)
+
 	return HoistResponse(resp, api.SyncResponse)
 }
 
 func (c *Client) doUpdateMethod(method string, base string, args interface{}, rtype api.ResponseType) (*api.Response, error) {
-	uri := c.url(version.APIVersion, base)
+	uri := c.url(version.APIVersion, c.projectURL(base))
 
 	buf := bytes.Buffer{}
 	err := json.NewEncoder(&buf).Encode(args)
@@ -393,9 +484,12 @@ func (c *Client) doUpdateMethod(method string, base string, args interface{}, rt
 
 	resp, err := c.Http.Do(req)
 	if err != nil {
+		c.logDebug("Request failed", "method", method, "url", uri, "err", err)
 		return nil, err
 	}
 
+	c.logDebug("Request", "method", method, "url", uri, "status", resp.StatusCode)
+
 	return HoistResponse(resp, rtype)
 }
 
@@ -441,8 +535,9 @@ func (c *Client) getRaw(uri string) (*http.Response, error) {
 
 func (c *Client) Websocket(operation string, secret string) (*websocket.Conn, error) {
 	query := url.Values{"secret": []string{secret}}
-	url := c.BaseWSURL + path.Join(operation, "websocket") + "?" + query.Encode()
-	return WebsocketDial(c.websocketDialer, url)
+	url := c.BaseWSURL + path.Join(operation, "websocket")
+	c.logDebug("Connecting to websocket", "url", url)
+	return WebsocketDial(c.websocketDialer, url+"?"+query.Encode())
 }
 
 func (c *Client) url(elem ...string) string {
@@ -546,6 +641,16 @@ func (c *Client) AmTrusted() bool {
 	return auth == "trusted"
 }
 
+// HasExtension returns true if the server supports a given API extension
+func (c *Client) HasExtension(extension string) bool {
+	serverStatus, err := c.ServerStatus()
+	if err != nil {
+		return false
+	}
+
+	return shared.StringInSlice(extension, serverStatus.APIExtensions)
+}
+
 func (c *Client) IsPublic() bool {
 	resp, err := c.GetServerConfig()
 	if err != nil {
@@ -1431,23 +1536,49 @@ func (c *Client) Init(name string, imgremote string, image string, profiles *[]s
 	return resp, nil
 }
 
-func (c *Client) LocalCopy(source string, name string, config map[string]string, profiles []string, ephemeral bool, containerOnly bool) (*api.Response, error) {
+func (c *Client) LocalCopy(source string, name string, config map[string]string, devices map[string]map[string]string, profiles []string, ephemeral bool, containerOnly bool, target string, createdAt time.Time, lastUsedAt time.Time) (*api.Response, error) {
+	return c.localCopyFrom(c.project, source, name, config, devices, profiles, ephemeral, containerOnly, target, createdAt, lastUsedAt)
+}
+
+// localCopyFrom is LocalCopy with the source taken from another project than
+// the one of the client
+func (c *Client) localCopyFrom(sourceProject string, source string, name string, config map[string]string, devices map[string]map[string]string, profiles []string, ephemeral bool, containerOnly bool, target string, createdAt time.Time, lastUsedAt time.Time) (*api.Response, error) {
 	if c.Remote.Public {
 		return nil, fmt.Errorf("This function isn't supported by public remotes.")
 	}
 
+	copySource := shared.Jmap{
+		"type":           "copy",
+		"source":         source,
+		"container_only": containerOnly,
+	}
+
+	if sourceProject != c.project {
+		if sourceProject == "" {
+			sourceProject = "default"
+		}
+
+		copySource["project"] = sourceProject
+	}
+
 	body := shared.Jmap{
-		"source": shared.Jmap{
-			"type":           "copy",
-			"source":         source,
-			"container_only": containerOnly,
-		},
+		"source":    copySource,
 		"name":      name,
 		"config":    config,
+		"devices":   devices,
 		"profiles":  profiles,
 		"ephemeral": ephemeral,
 	}
 
+	if target != "" {
+		body["target"] = target
+	}
+
+	if !createdAt.IsZero() {
+		body["created_at"] = createdAt
+		body["last_used_at"] = lastUsedAt
+	}
+
 	return c.post("containers", body, api.AsyncResponse)
 }
 
@@ -1999,7 +2130,7 @@ func (c *Client) DeleteFile(container string, p string) error {
 	return nil
 }
 
-func (c *Client) GetMigrationSourceWS(container string, stateful bool, containerOnly bool) (*api.Response, error) {
+func (c *Client) GetMigrationSourceWS(container string, stateful bool, containerOnly bool, bwlimit string, allowInconsistent bool, compression string, protocol string, snapshots []string, excludes []string, refresh bool) (*api.Response, error) {
 	if c.Remote.Public {
 		return nil, fmt.Errorf("This function isn't supported by public remotes.")
 	}
@@ -2019,14 +2150,73 @@ func (c *Client) GetMigrationSourceWS(container string, stateful bool, container
 		body["container_only"] = containerOnly
 	}
 
+	if bwlimit != "" {
+		body["bwlimit"] = bwlimit
+	}
+
+	if allowInconsistent {
+		body["allow_inconsistent"] = true
+	}
+
+	if compression != "" {
+		body["compression"] = compression
+	}
+
+	if protocol != "" {
+		body["protocol"] = protocol
+	}
+
+	if len(snapshots) > 0 {
+		body["snapshots"] = snapshots
+	}
+
+	if len(excludes) > 0 {
+		body["excludes"] = excludes
+	}
+
+	// The source then skips the snapshots the destination already has
+	if refresh {
+		body["refresh"] = true
+	}
+
 	return c.post(url, body, api.AsyncResponse)
 }
 
+// PushMigrationSource sets up a container to be migrated in push mode: the
+// source connects to the websockets of the target operation on its own,
+// which works when the destination can't reach the source. The returned
+// operation has no websockets. Snapshots can't be pushed.
+func (c *Client) PushMigrationSource(container string, stateful bool, containerOnly bool, bwlimit string, allowInconsistent bool, compression string, protocol string, snapshots []string, excludes []string, refresh bool, target api.ContainerPostTarget) (*api.Response, error) {
+	if c.Remote.Public {
+		return nil, fmt.Errorf("This function isn't supported by public remotes.")
+	}
+
+	if shared.IsSnapshot(container) {
+		return nil, fmt.Errorf("Snapshots can't be migrated in push mode")
+	}
+
+	req := api.ContainerPost{
+		Migration:         true,
+		Live:              stateful,
+		ContainerOnly:     containerOnly,
+		Bwlimit:           bwlimit,
+		AllowInconsistent: allowInconsistent,
+		Compression:       compression,
+		Protocol:          protocol,
+		Snapshots:         snapshots,
+		Excludes:          excludes,
+		Refresh:           refresh,
+		Target:            &target,
+	}
+
+	return c.post(fmt.Sprintf("containers/%s", container), req, api.AsyncResponse)
+}
+
 func (c *Client) MigrateFrom(name string, operation string, certificate string,
 	sourceSecrets map[string]string, architecture string, config map[string]string,
 	devices map[string]map[string]string, profiles []string,
 	baseImage string, ephemeral bool, push bool, sourceClient *Client,
-	sourceOperation string, containerOnly bool) (*api.Response, error) {
+	sourceOperation string, containerOnly bool, refresh bool, target string, createdAt time.Time, lastUsedAt time.Time, compression string) (*api.Response, error) {
 	if c.Remote.Public {
 		return nil, fmt.Errorf("This function isn't supported by public remotes.")
 	}
@@ -2037,6 +2227,14 @@ func (c *Client) MigrateFrom(name string, operation string, certificate string,
 		"container_only": containerOnly,
 	}
 
+	if refresh {
+		source["refresh"] = true
+	}
+
+	if compression != "" {
+		source["compression"] = compression
+	}
+
 	if push {
 		source["mode"] = "push"
 		source["live"] = false
@@ -2062,6 +2260,21 @@ func (c *Client) MigrateFrom(name string, operation string, certificate string,
 		"source":       source,
 	}
 
+	if target != "" {
+		body["target"] = target
+	}
+
+	if !createdAt.IsZero() {
+		body["created_at"] = createdAt
+		body["last_used_at"] = lastUsedAt
+	}
+
+	// Without a client to relay through, the source pushes the data on
+	// its own and only needs the secrets of the new operation.
+	if push && sourceClient == nil {
+		return c.post("containers", body, api.AsyncResponse)
+	}
+
 	if source["mode"] == "push" {
 		// Check source server secrets.
 		sourceControlSecret, ok := sourceSecrets["control"]
@@ -2200,6 +2413,643 @@ func (c *Client) MigrateFrom(name string, operation string, certificate string,
 	return c.post("containers", body, api.AsyncResponse)
 }
 
+// ContainerCopyArgs represents the options of a copy through CopyContainer
+type ContainerCopyArgs struct {
+	// Name of the new container, picked by the server when empty
+	Name string
+
+	// Architecture of the new container, the one of the source when empty.
+	// Local copies always keep the architecture of the source.
+	Architecture string
+
+	// Config, devices and profiles of the new container, those of the
+	// source are used when nil
+	Config   map[string]string
+	Devices  map[string]map[string]string
+	Profiles []string
+
+	Ephemeral     bool
+	ContainerOnly bool
+	Stateful      bool
+
+	// Keep the volatile keys of the source container
+	KeepVolatile bool
+
+	// Keep the volatile keys starting with one of these prefixes even
+	// without KeepVolatile, e.g. volatile.eth0.hwaddr
+	PreserveVolatile []string
+
+	// Only transfer the differences to an existing container
+	Refresh bool
+
+	Target     string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+
+	// Transfer options, only used between different servers
+	Bwlimit           string
+	AllowInconsistent bool
+	Compression       string
+	Protocol          string
+	Snapshots         []string
+	Excludes          []string
+	Relay             bool
+	Retries           int
+
+	// Called with the source and destination operations when a transfer
+	// between different servers starts
+	OnTransfer func(sourceOperation string, destOperation string)
+
+	// Called when a transfer between different servers starts with whether
+	// it includes the runtime state of the container. The source only sends
+	// its disk when the container isn't running anymore.
+	OnStateful func(stateful bool)
+
+	// Called when the destination takes a while to list its profiles
+	// before the copy
+	OnProfilesSlow func()
+
+	// Called when the destination can't reach the migration address of the
+	// source remote, the other addresses of the source are tried next
+	OnMigrationAddressFailed func(address string, err error)
+
+	// Return as soon as the copy started instead of waiting for it to
+	// complete. Relayed transfers need the client until they complete.
+	NoWait bool
+
+	// Poll the operations at this interval instead of waiting on them on
+	// the servers
+	WaitInterval time.Duration
+
+	// Have the source push the data to the destination, which then
+	// doesn't need to reach the source
+	Push bool
+}
+
+// CopyContainer copies a container or snapshot of this server to dest, as a
+// local copy when dest is the same server and as a migration otherwise. It
+// returns the operation which created the new container once it's done, or
+// cancels the copy when ctx is done first.
+func (c *Client) CopyContainer(ctx context.Context, source string, dest *Client, args ContainerCopyArgs) (*api.Response, error) {
+	if c.Remote.Public {
+		return nil, fmt.Errorf("This function isn't supported by public remotes.")
+	}
+
+	if args.NoWait && args.Relay {
+		return nil, fmt.Errorf("Relayed copies can't be started without waiting for them")
+	}
+
+	var architecture string
+	var config map[string]string
+	var devices map[string]map[string]string
+	var profiles []string
+
+	if shared.IsSnapshot(source) {
+		snapshot, err := c.SnapshotInfo(source)
+		if err != nil {
+			return nil, err
+		}
+
+		architecture = snapshot.Architecture
+		config = snapshot.Config
+		devices = snapshot.Devices
+		profiles = snapshot.Profiles
+
+		// A snapshot becomes a standalone container
+		args.ContainerOnly = true
+	} else {
+		ct, err := c.ContainerInfo(source)
+		if err != nil {
+			return nil, err
+		}
+
+		architecture = ct.Architecture
+		config = ct.Config
+		devices = ct.Devices
+		profiles = ct.Profiles
+	}
+
+	if args.Architecture != "" {
+		architecture = args.Architecture
+	}
+
+	if args.Config != nil {
+		config = args.Config
+	}
+
+	if args.Devices != nil {
+		devices = args.Devices
+	}
+
+	if args.Profiles != nil {
+		profiles = args.Profiles
+	}
+
+	// TODO: presumably we want to do this for copying snapshots too? We
+	// need to think a bit more about how we track the baseImage in the
+	// face of LVM and snapshots in general; this will probably make more
+	// sense once that work is done.
+	baseImage := config["volatile.base_image"]
+
+	if !args.KeepVolatile {
+		stripped := map[string]string{}
+		for k, v := range config {
+			if !strings.HasPrefix(k, "volatile") || hasAnyPrefix(k, args.PreserveVolatile) {
+				stripped[k] = v
+			}
+		}
+
+		config = stripped
+	}
+
+	missing, err := dest.missingProfilesContext(ctx, profiles, args.OnProfilesSlow)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		return nil, MissingProfilesError{Profiles: missing}
+	}
+
+	// Do a local copy if the servers are the same, otherwise do a migration
+	if c.Name == dest.Name {
+		if source == args.Name && c.project == dest.project {
+			return nil, fmt.Errorf("can't copy to the same container name")
+		}
+
+		// The copy is created in the project of the destination
+		resp, err := dest.localCopyFrom(c.project, source, args.Name, config, devices, profiles, args.Ephemeral, args.ContainerOnly, args.Target, args.CreatedAt, args.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Infof("Local copy started on %s, operation %s", c.BaseURL, resp.Operation)
+
+		if args.NoWait {
+			return resp, nil
+		}
+
+		err = c.WaitForSuccessInterval(ctx, resp.Operation, args.WaitInterval)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	}
+
+	if baseImage != "" {
+		logger.Infof("Recording base image %s on the destination", baseImage)
+	} else {
+		logger.Infof("No base image to record on the destination, the container wasn't created from a known image")
+	}
+
+	if args.Push {
+		return c.pushContainer(ctx, source, dest, args, architecture, config, devices, profiles, baseImage)
+	}
+
+	// The migration address of the remote is enough on its own
+	override := ""
+	if c.Remote != nil && !args.Relay {
+		override = c.Remote.MigrationAddress
+	}
+
+	// Look the addresses up before creating the source operation so it
+	// isn't left behind when the destination has nothing to connect to.
+	addresses, err := c.Addresses()
+	if err != nil && (err != errNoAddresses || override == "") {
+		return nil, err
+	}
+
+	if len(addresses) == 0 && override == "" {
+		return nil, errNoAddresses
+	}
+
+	// Use the address we already reach the source on first, it's the
+	// one most likely to be routable from the destination too.
+	addresses = preferAddress(addresses, c.BaseURL)
+
+	// When relaying, the data goes through our own connection to the
+	// source so there's no need to try every one of its addresses.
+	if args.Relay {
+		addresses = addresses[:1]
+	}
+
+	addresses = migrationAddresses(addresses, override)
+
+	sourceWSResponse, secrets, err := c.migrationSource(source, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// The source only hands out a criu secret when it sends the state
+	if args.OnStateful != nil {
+		_, ok := secrets["criu"]
+		args.OnStateful(ok)
+	}
+
+	/* Since we're trying a bunch of different network ports that
+	 * may be invalid, we can get "bad handshake" errors when the
+	 * websocket code tries to connect. If the first error is a
+	 * real error, but the subsequent errors are only network
+	 * errors, we should try to report the first real error. Of
+	 * course, if all the errors are websocket errors, let's just
+	 * report that.
+	 */
+	var migrationErrFromClient error
+
+	// Whether the source completed a transfer the destination then failed,
+	// the source may need cleaning up
+	sourceDone := false
+	transferred := false
+
+	// Transfers interrupted by the network are started over, each one
+	// needing a new source operation
+	transfers := 0
+	for i := 0; i < len(addresses); i++ {
+		addr := addresses[i]
+		var migration *api.Response
+
+		if ctx.Err() != nil {
+			c.CancelOperation(sourceWSResponse.Operation)
+			return nil, ctx.Err()
+		}
+
+		sourceWSUrl := "https://" + addr + sourceWSResponse.Operation
+		logger.Infof("Trying migration source address %s (%s)", addr, sourceWSUrl)
+
+		for attempt := 0; ; attempt++ {
+			migration, migrationErrFromClient = dest.MigrateFrom(args.Name, sourceWSUrl, c.Certificate, secrets, architecture, config, devices, profiles, baseImage, args.Ephemeral, args.Relay, c, sourceWSResponse.Operation, args.ContainerOnly, args.Refresh, args.Target, args.CreatedAt, args.LastUsedAt, args.Compression)
+
+			// Only network errors are worth retrying, anything else
+			// came from the server and would just fail again.
+			if migrationErrFromClient == nil || attempt >= args.Retries || !isNetworkError(migrationErrFromClient) || ctx.Err() != nil {
+				break
+			}
+
+			select {
+			case <-time.After(time.Second << uint(attempt)):
+			case <-ctx.Done():
+			}
+		}
+
+		// The name is taken whichever address is used
+		if migrationErrFromClient == LXDErrors[http.StatusConflict] {
+			c.CancelOperation(sourceWSResponse.Operation)
+			return nil, migrationErrFromClient
+		}
+
+		if migrationErrFromClient != nil {
+			logger.Infof("Migration through %s failed: %s", addr, migrationErrFromClient)
+			if addr == override && args.OnMigrationAddressFailed != nil {
+				args.OnMigrationAddressFailed(addr, migrationErrFromClient)
+			}
+
+			continue
+		}
+
+		logger.Infof("Migration started through %s, source operation %s, destination operation %s", addr, sourceWSResponse.Operation, migration.Operation)
+
+		if args.OnTransfer != nil {
+			args.OnTransfer(sourceWSResponse.Operation, migration.Operation)
+		}
+
+		if args.NoWait {
+			return migration, nil
+		}
+
+		transferred = true
+		sourceOpErr, destOpErr := waitForMigration(ctx, c, sourceWSResponse.Operation, dest, migration.Operation, args.WaitInterval)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if destOpErr != nil && isNetworkError(destOpErr) && transfers < args.Retries {
+			dest.CancelOperation(migration.Operation)
+			c.CancelOperation(sourceWSResponse.Operation)
+
+			// The next transfer creates the container again
+			discardErr := dest.discardTransfer(migration.Operation, args.Name, args.Refresh)
+			if discardErr == nil {
+				logger.Infof("Transfer through %s interrupted, starting it over: %s", addr, destOpErr)
+
+				select {
+				case <-time.After(time.Second << uint(transfers)):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+
+				transfers++
+				sourceWSResponse, secrets, err = c.migrationSource(source, args)
+				if err != nil {
+					return nil, err
+				}
+
+				// Go through the same address again
+				i--
+				continue
+			}
+
+			logger.Infof("Unable to start the transfer through %s over: %s", addr, discardErr)
+		}
+
+		// With the source gone, there's no point in trying other addresses
+		if sourceOpErr != nil && destOpErr != nil {
+			return nil, MigrationError{fmt.Errorf("Migration failed on source host: %s\nMigration failed on target host: %s", sourceOpErr, destOpErr)}
+		}
+
+		if destOpErr != nil {
+			logger.Infof("Transfer through %s failed: %s", addr, destOpErr)
+			migrationErrFromClient = destOpErr
+			sourceDone = sourceOpErr == nil
+			if addr == override && args.OnMigrationAddressFailed != nil {
+				args.OnMigrationAddressFailed(addr, destOpErr)
+			}
+			continue
+		}
+
+		if sourceOpErr != nil {
+			return nil, MigrationError{sourceOpErr}
+		}
+
+		return migration, nil
+	}
+
+	// Check for an error at the source
+	sourceOp, sourceErr := c.GetOperation(sourceWSResponse.Operation)
+	if sourceErr == nil && sourceOp.Err != "" {
+		return nil, MigrationError{fmt.Errorf("Migration failed on source host: %s", sourceOp.Err)}
+	}
+
+	// Return the error from destination, which refused the migration
+	// when none was started
+	err = targetError(migrationErrFromClient, sourceDone)
+	if transferred {
+		return nil, MigrationError{err}
+	}
+
+	return nil, err
+}
+
+// migrationSource creates the source operation of a migration in pull mode
+// and returns it along with the secrets to connect to it
+func (c *Client) migrationSource(source string, args ContainerCopyArgs) (*api.Response, map[string]string, error) {
+	resp, err := c.GetMigrationSourceWS(source, args.Stateful, args.ContainerOnly, args.Bwlimit, args.AllowInconsistent, args.Compression, args.Protocol, args.Snapshots, args.Excludes, args.Refresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	op, err := resp.MetadataAsOperation()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets := map[string]string{}
+	for k, v := range op.Metadata {
+		secrets[k] = v.(string)
+	}
+
+	c.logDebug("Migration source created", "operation", resp.Operation, "metadata", redactSecrets(op.Metadata))
+
+	return resp, secrets, nil
+}
+
+// pushContainer does the migration of CopyContainer in push mode. The
+// destination operation is created first and the source then connects to it
+// through the address the destination is reached on.
+func (c *Client) pushContainer(ctx context.Context, source string, dest *Client, args ContainerCopyArgs, architecture string, config map[string]string, devices map[string]map[string]string, profiles []string, baseImage string) (*api.Response, error) {
+	if !strings.HasPrefix(dest.BaseURL, "https://") {
+		return nil, fmt.Errorf("The destination remote must be reached over the network to push to it")
+	}
+
+	// The destination expects a live migration when given a criu secret
+	pushSecrets := map[string]string{}
+	if args.Stateful {
+		pushSecrets["criu"] = ""
+	}
+
+	migration, err := dest.MigrateFrom(args.Name, "", "", pushSecrets, architecture, config, devices, profiles, baseImage, args.Ephemeral, true, nil, "", args.ContainerOnly, args.Refresh, args.Target, args.CreatedAt, args.LastUsedAt, args.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := migration.MetadataAsOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	destSecrets := map[string]string{}
+	for k, v := range op.Metadata {
+		destSecrets[k] = v.(string)
+	}
+
+	c.logDebug("Migration target created", "operation", migration.Operation, "metadata", redactSecrets(op.Metadata))
+
+	target := api.ContainerPostTarget{
+		Certificate: dest.Certificate,
+		Operation:   dest.BaseURL + migration.Operation,
+		Websockets:  destSecrets,
+	}
+
+	sourceResp, err := c.PushMigrationSource(source, args.Stateful, args.ContainerOnly, args.Bwlimit, args.AllowInconsistent, args.Compression, args.Protocol, args.Snapshots, args.Excludes, args.Refresh, target)
+	if err != nil {
+		dest.CancelOperation(migration.Operation)
+		return nil, err
+	}
+
+	logger.Infof("Migration pushed to %s, source operation %s, destination operation %s", dest.BaseURL, sourceResp.Operation, migration.Operation)
+
+	// The destination fails the migration when expecting a state it
+	// doesn't get
+	if args.OnStateful != nil {
+		args.OnStateful(args.Stateful)
+	}
+
+	if args.OnTransfer != nil {
+		args.OnTransfer(sourceResp.Operation, migration.Operation)
+	}
+
+	if args.NoWait {
+		return migration, nil
+	}
+
+	// Unlike in pull mode, the source has to be waited for as well since
+	// it's the one connecting
+	sourceOpErr, destOpErr := waitForMigration(ctx, c, sourceResp.Operation, dest, migration.Operation, args.WaitInterval)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if sourceOpErr != nil && destOpErr != nil {
+		return nil, MigrationError{fmt.Errorf("Migration failed on source host: %s\nMigration failed on target host: %s", sourceOpErr, destOpErr)}
+	}
+
+	if sourceOpErr != nil {
+		return nil, MigrationError{fmt.Errorf("Migration failed on source host: %s", sourceOpErr)}
+	}
+
+	if destOpErr != nil {
+		return nil, MigrationError{targetError(destOpErr, true)}
+	}
+
+	return migration, nil
+}
+
+// targetError returns the error of a migration which failed on the
+// destination, telling whether the source finished its side of it
+func targetError(err error, sourceDone bool) error {
+	if sourceDone {
+		return fmt.Errorf("Migration failed on target host: %s (the source finished sending the container)", err)
+	}
+
+	return fmt.Errorf("Migration failed on target host: %s (the source didn't finish sending the container)", err)
+}
+
+// hasAnyPrefix returns whether s starts with one of the prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// migrationAddresses puts the migration address of the remote in front of
+// the addresses, the others are only tried when it can't be reached
+func migrationAddresses(addresses []string, override string) []string {
+	if override == "" {
+		return addresses
+	}
+
+	result := []string{override}
+	for _, addr := range addresses {
+		if addr != override {
+			result = append(result, addr)
+		}
+	}
+
+	return result
+}
+
+// preferAddress moves the address of the URL to the front of the addresses,
+// dropping duplicates
+func preferAddress(addresses []string, baseURL string) []string {
+	preferred := ""
+	u, err := url.Parse(baseURL)
+	if err == nil && u.Scheme == "https" {
+		preferred = u.Host
+	}
+
+	result := []string{}
+	if shared.StringInSlice(preferred, addresses) {
+		result = append(result, preferred)
+	}
+
+	for _, addr := range addresses {
+		if !shared.StringInSlice(addr, result) {
+			result = append(result, addr)
+		}
+	}
+
+	return result
+}
+
+type operationWaiter interface {
+	WaitForSuccessInterval(ctx context.Context, waitURL string, interval time.Duration) error
+}
+
+// waitForMigration waits for both ends of a migration to be done. There's
+// nothing to wait for on the destination when it has no operation.
+func waitForMigration(ctx context.Context, source operationWaiter, sourceOp string, dest operationWaiter, destOp string, interval time.Duration) (sourceErr error, destErr error) {
+	destDone := make(chan error, 1)
+	if destOp != "" {
+		go func() {
+			destDone <- dest.WaitForSuccessInterval(ctx, destOp, interval)
+		}()
+	}
+
+	sourceErr = source.WaitForSuccessInterval(ctx, sourceOp, interval)
+	if destOp != "" {
+		destErr = <-destDone
+	}
+
+	return sourceErr, destErr
+}
+
+// networkErrors are the errors of a server failing to reach another one. The
+// destination only reports them as the error of its operation.
+var networkErrors = []string{
+	"bad handshake",
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"no route to host",
+}
+
+// isNetworkError returns whether the error comes from the connection rather
+// than from the server itself
+func isNetworkError(err error) bool {
+	if err == websocket.ErrBadHandshake {
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	if ok {
+		return true
+	}
+
+	for _, text := range networkErrors {
+		if strings.Contains(err.Error(), text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// discardTransfer waits for the destination operation of an interrupted
+// transfer to be over and deletes the container it was creating, so that it
+// can be transferred again. A refreshed container is kept, the next transfer
+// syncs over it.
+func (c *Client) discardTransfer(operation string, name string, refresh bool) error {
+	names := []string{name}
+	op, err := c.WaitFor(operation)
+	if err == nil && len(op.Resources["containers"]) > 0 {
+		names = []string{}
+		for _, url := range op.Resources["containers"] {
+			names = append(names, path.Base(url))
+		}
+	} else if err != nil && err != LXDErrors[http.StatusNotFound] {
+		return err
+	}
+
+	if refresh {
+		return nil
+	}
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("The name of the interrupted copy isn't known")
+		}
+
+		resp, err := c.Delete(name)
+		if err == LXDErrors[http.StatusNotFound] {
+			continue
+		}
+
+		if err == nil {
+			err = c.WaitForSuccess(resp.Operation)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *Client) Rename(name string, newName string) (*api.Response, error) {
 	if c.Remote.Public {
 		return nil, fmt.Errorf("This function isn't supported by public remotes.")
@@ -2223,6 +3073,11 @@ func (c *Client) Rename(name string, newName string) (*api.Response, error) {
 
 /* Wait for an operation */
 func (c *Client) WaitFor(waitURL string) (*api.Operation, error) {
+	return c.WaitForContext(context.Background(), waitURL)
+}
+
+// WaitForContext is WaitFor with the wait aborted when ctx is done
+func (c *Client) WaitForContext(ctx context.Context, waitURL string) (*api.Operation, error) {
 	if len(waitURL) < 1 {
 		return nil, fmt.Errorf("invalid wait url %s", waitURL)
 	}
@@ -2232,12 +3087,18 @@ func (c *Client) WaitFor(waitURL string) (*api.Operation, error) {
 	 * "/<version>/operations/" in it; we chop off the leading / and pass
 	 * it to url directly.
 	 */
-	resp, err := c.baseGet(c.url(waitURL, "wait"))
+	resp, err := c.baseGetContext(ctx, c.url(waitURL, "wait"))
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.MetadataAsOperation()
+	op, err := resp.MetadataAsOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	c.logDebug("Operation done waiting", "url", waitURL, "status", op.Status, "err", op.Err)
+	return op, nil
 }
 
 func (c *Client) GetOperation(url string) (*api.Operation, error) {
@@ -2249,8 +3110,25 @@ func (c *Client) GetOperation(url string) (*api.Operation, error) {
 	return resp.MetadataAsOperation()
 }
 
+func (c *Client) CancelOperation(url string) error {
+	_, err := c.delete(fmt.Sprintf("operations/%s", path.Base(url)), nil, api.SyncResponse)
+	return err
+}
+
 func (c *Client) WaitForSuccess(waitURL string) error {
-	op, err := c.WaitFor(waitURL)
+	return c.WaitForSuccessContext(context.Background(), waitURL)
+}
+
+// WaitForSuccessContext waits for the operation to succeed. When ctx is done
+// first, the operation is cancelled if it supports it and the error of the
+// context is returned.
+func (c *Client) WaitForSuccessContext(ctx context.Context, waitURL string) error {
+	op, err := c.WaitForContext(ctx, waitURL)
+	if ctx.Err() != nil {
+		c.CancelOperation(waitURL)
+		return ctx.Err()
+	}
+
 	if err != nil {
 		return err
 	}
@@ -2262,6 +3140,45 @@ func (c *Client) WaitForSuccess(waitURL string) error {
 	return fmt.Errorf(op.Err)
 }
 
+// WaitForSuccessInterval is WaitForSuccessContext polling the operation at
+// the interval rather than waiting on it on the server, which it still does
+// when the interval is zero.
+func (c *Client) WaitForSuccessInterval(ctx context.Context, waitURL string, interval time.Duration) error {
+	if interval <= 0 {
+		return c.WaitForSuccessContext(ctx, waitURL)
+	}
+
+	for {
+		resp, err := c.baseGetContext(ctx, c.url(waitURL))
+		if ctx.Err() != nil {
+			c.CancelOperation(waitURL)
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		op, err := resp.MetadataAsOperation()
+		if err != nil {
+			return err
+		}
+
+		if op.StatusCode == api.Success {
+			return nil
+		}
+
+		if op.StatusCode.IsFinal() {
+			return fmt.Errorf(op.Err)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+		}
+	}
+}
+
 func (c *Client) WaitForSuccessOp(waitURL string) (*api.Operation, error) {
 	op, err := c.WaitFor(waitURL)
 	if err != nil {
@@ -2534,6 +3451,79 @@ func (c *Client) ListProfiles() ([]api.Profile, error) {
 	return profiles, nil
 }
 
+// MissingProfilesError is returned by CopyContainer when some of the
+// profiles of the new container don't exist on the destination.
+type MissingProfilesError struct {
+	Profiles []string
+}
+
+func (e MissingProfilesError) Error() string {
+	return fmt.Sprintf("The following profiles don't exist on the target: %s", strings.Join(e.Profiles, ", "))
+}
+
+// MigrationError is the error of a migration between two servers which
+// failed once started, as opposed to one the servers refused
+type MigrationError struct {
+	Err error
+}
+
+func (e MigrationError) Error() string {
+	return e.Err.Error()
+}
+
+// MissingProfiles returns which of the profiles don't exist on the server, sorted
+func (c *Client) MissingProfiles(profiles []string) ([]string, error) {
+	if len(profiles) == 0 {
+		return []string{}, nil
+	}
+
+	existing, err := c.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, profile := range existing {
+		names = append(names, profile.Name)
+	}
+
+	return shared.NewStringSet(profiles).Difference(shared.NewStringSet(names)), nil
+}
+
+// How long listing the profiles may take before it's reported as slow
+const profilesSlowDelay = 2 * time.Second
+
+// missingProfilesContext is MissingProfiles giving up once ctx is done, onSlow
+// is called when the server takes more than profilesSlowDelay to answer
+func (c *Client) missingProfilesContext(ctx context.Context, profiles []string, onSlow func()) ([]string, error) {
+	type result struct {
+		missing []string
+		err     error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		missing, err := c.MissingProfiles(profiles)
+		done <- result{missing, err}
+	}()
+
+	slow := time.NewTimer(profilesSlowDelay)
+	defer slow.Stop()
+
+	for {
+		select {
+		case r := <-done:
+			return r.missing, r.err
+		case <-slow.C:
+			if onSlow != nil {
+				onSlow()
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("destination unreachable while listing profiles: %s", ctx.Err())
+		}
+	}
+}
+
 func (c *Client) AssignProfile(container, profile string) (*api.Response, error) {
 	if c.Remote.Public {
 		return nil, fmt.Errorf("This function isn't supported by public remotes.")
@@ -2996,6 +3986,99 @@ func (c *Client) StoragePoolVolumeTypeDelete(pool string, volume string, volumeT
 	return err
 }
 
+// StoragePoolVolumeCopy copies a custom storage volume to a pool of the
+// destination, which pulls it from the first address of the source it can
+// reach.
+func (c *Client) StoragePoolVolumeCopy(ctx context.Context, pool string, volume string, dest *Client, destPool string) error {
+	if c.Remote.Public || dest.Remote.Public {
+		return fmt.Errorf("This function isn't supported by public remotes.")
+	}
+
+	vol, err := c.StoragePoolVolumeTypeGet(pool, volume, "custom")
+	if err != nil {
+		return err
+	}
+
+	override := c.Remote.MigrationAddress
+	addresses, err := c.Addresses()
+	if err != nil && (err != errNoAddresses || override == "") {
+		return err
+	}
+
+	if len(addresses) == 0 && override == "" {
+		return errNoAddresses
+	}
+
+	addresses = migrationAddresses(preferAddress(addresses, c.BaseURL), override)
+
+	sourceResp, err := c.post(fmt.Sprintf("storage-pools/%s/volumes/custom/%s", pool, volume), shared.Jmap{"migration": true}, api.AsyncResponse)
+	if err != nil {
+		return err
+	}
+
+	op, err := sourceResp.MetadataAsOperation()
+	if err != nil {
+		return err
+	}
+
+	secrets := map[string]string{}
+	for k, v := range op.Metadata {
+		secrets[k] = v.(string)
+	}
+
+	// The destination deletes the volume again when it can't connect, so
+	// the next address starts from scratch
+	var lastErr error
+	for _, addr := range addresses {
+		body := shared.Jmap{
+			"name":        volume,
+			"type":        "custom",
+			"config":      vol.Config,
+			"description": vol.Description,
+			"source": shared.Jmap{
+				"type":        "migration",
+				"mode":        "pull",
+				"operation":   "https://" + addr + sourceResp.Operation,
+				"certificate": c.Certificate,
+				"secrets":     secrets,
+			},
+		}
+
+		destResp, err := dest.post(fmt.Sprintf("storage-pools/%s/volumes/custom", destPool), body, api.AsyncResponse)
+		if err != nil {
+			c.CancelOperation(sourceResp.Operation)
+			return err
+		}
+
+		// The source only finishes once the destination connected
+		lastErr = dest.WaitForSuccessContext(ctx, destResp.Operation)
+		if ctx.Err() != nil {
+			c.CancelOperation(sourceResp.Operation)
+			return ctx.Err()
+		}
+
+		if lastErr != nil && isNetworkError(lastErr) {
+			logger.Infof("Volume transfer through %s failed: %s", addr, lastErr)
+			continue
+		}
+
+		if lastErr != nil {
+			c.CancelOperation(sourceResp.Operation)
+			return MigrationError{lastErr}
+		}
+
+		err = c.WaitForSuccessContext(ctx, sourceResp.Operation)
+		if err != nil {
+			return MigrationError{err}
+		}
+
+		return nil
+	}
+
+	c.CancelOperation(sourceResp.Operation)
+	return MigrationError{lastErr}
+}
+
 // Helper to set up a progess handler for download operations
 func wireDownloadProgressHandler(c *Client, progressHandler func(progress string), operation *string) {
 	handler := func(msg interface{}) {
@@ -0,0 +1,574 @@
+package lxd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lxc/lxd/shared/api"
+)
+
+type fakeWaiter struct {
+	errors map[string]error
+	waited []string
+}
+
+func (f *fakeWaiter) WaitForSuccessInterval(ctx context.Context, waitURL string, interval time.Duration) error {
+	f.waited = append(f.waited, waitURL)
+	return f.errors[waitURL]
+}
+
+func TestWaitForMigration(t *testing.T) {
+	sourceFail := fmt.Errorf("source failed")
+	destFail := fmt.Errorf("dest failed")
+
+	tests := []struct {
+		name       string
+		sourceErr  error
+		destErr    error
+		destOp     string
+		destWaited bool
+	}{
+		{"success", nil, nil, "/1.0/operations/dest", true},
+		{"both fail", sourceFail, destFail, "/1.0/operations/dest", true},
+		{"dest only fails", nil, destFail, "/1.0/operations/dest", true},
+		{"no dest operation", nil, nil, "", false},
+	}
+
+	for _, test := range tests {
+		source := &fakeWaiter{errors: map[string]error{"/1.0/operations/source": test.sourceErr}}
+		dest := &fakeWaiter{errors: map[string]error{test.destOp: test.destErr}}
+
+		sourceErr, destErr := waitForMigration(context.Background(), source, "/1.0/operations/source", dest, test.destOp, 0)
+		if sourceErr != test.sourceErr {
+			t.Errorf("%s: got source error %v, expected %v", test.name, sourceErr, test.sourceErr)
+		}
+
+		if destErr != test.destErr {
+			t.Errorf("%s: got destination error %v, expected %v", test.name, destErr, test.destErr)
+		}
+
+		if len(source.waited) != 1 {
+			t.Errorf("%s: source waited on %d times", test.name, len(source.waited))
+		}
+
+		if (len(dest.waited) == 1) != test.destWaited {
+			t.Errorf("%s: destination waited on %d times", test.name, len(dest.waited))
+		}
+	}
+}
+
+func TestPreferAddress(t *testing.T) {
+	tests := []struct {
+		addresses []string
+		baseURL   string
+		result    []string
+	}{
+		{[]string{"10.0.0.1:8443", "192.168.1.1:8443"}, "https://192.168.1.1:8443", []string{"192.168.1.1:8443", "10.0.0.1:8443"}},
+		{[]string{"192.168.1.1:8443", "10.0.0.1:8443", "192.168.1.1:8443"}, "https://192.168.1.1:8443", []string{"192.168.1.1:8443", "10.0.0.1:8443"}},
+		{[]string{"10.0.0.1:8443", "192.168.1.1:8443"}, "https://other:8443", []string{"10.0.0.1:8443", "192.168.1.1:8443"}},
+		{[]string{"10.0.0.1:8443", "192.168.1.1:8443"}, "http://unix.socket", []string{"10.0.0.1:8443", "192.168.1.1:8443"}},
+	}
+
+	for _, test := range tests {
+		result := preferAddress(test.addresses, test.baseURL)
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%v with %s: got %v, expected %v", test.addresses, test.baseURL, result, test.result)
+		}
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	metadata := map[string]interface{}{
+		"control": "secret1",
+		"fs":      "secret2",
+		"criu":    "secret3",
+		"other":   "value",
+	}
+
+	redacted := redactSecrets(metadata)
+	expected := map[string]interface{}{
+		"control": "<redacted>",
+		"fs":      "<redacted>",
+		"criu":    "<redacted>",
+		"other":   "value",
+	}
+
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("got %v, expected %v", redacted, expected)
+	}
+
+	if metadata["fs"] != "secret2" {
+		t.Errorf("the original metadata was modified")
+	}
+}
+
+func TestMissingProfilesProject(t *testing.T) {
+	// Each project has its own profiles
+	profiles := map[string]string{
+		"":    `[{"name": "default"}]`,
+		"dev": `[{"name": "default"}, {"name": "web"}]`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": %s}`, profiles[r.URL.Query().Get("project")])
+	}))
+	defer server.Close()
+
+	c := &Client{BaseURL: server.URL, Remote: &RemoteConfig{}}
+
+	missing, err := c.MissingProfiles([]string{"default", "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(missing, []string{"web"}) {
+		t.Errorf("default project: got %v, expected [web]", missing)
+	}
+
+	missing, err = c.UseProject("dev").MissingProfiles([]string{"default", "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(missing) != 0 {
+		t.Errorf("dev project: got %v, expected none", missing)
+	}
+
+	if c.project != "" {
+		t.Errorf("UseProject changed the original client")
+	}
+}
+
+func TestHasAnyPrefix(t *testing.T) {
+	prefixes := []string{"volatile.eth0.", "volatile.base_image"}
+
+	tests := map[string]bool{
+		"volatile.eth0.hwaddr":      true,
+		"volatile.base_image":       true,
+		"volatile.eth1.hwaddr":      false,
+		"volatile.last_state.power": false,
+	}
+
+	for s, expected := range tests {
+		if hasAnyPrefix(s, prefixes) != expected {
+			t.Errorf("%s: expected %v", s, expected)
+		}
+	}
+
+	if hasAnyPrefix("volatile.eth0.hwaddr", nil) {
+		t.Errorf("matched without any prefix")
+	}
+}
+
+func TestMissingProfilesContext(t *testing.T) {
+	block := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	c := &Client{BaseURL: server.URL, Remote: &RemoteConfig{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.missingProfilesContext(ctx, []string{"default"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "destination unreachable while listing profiles") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCopyContainerProjects(t *testing.T) {
+	copied := map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := r.URL.Query().Get("project")
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0/containers/c1" && project == "src":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1", "architecture": "x86_64", "config": {}, "devices": {}, "profiles": ["default"]}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/profiles" && project == "dst":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": [{"name": "default"}]}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers" && project == "dst":
+			json.NewDecoder(r.Body).Decode(&copied)
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/1234", "metadata": {"id": "1234", "resources": {"containers": ["/1.0/containers/c1"]}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Name: "remote", BaseURL: server.URL, Remote: &RemoteConfig{}}
+	source := c.UseProject("src")
+	dest := c.UseProject("dst")
+
+	// The same name is fine in another project
+	_, err := source.CopyContainer(context.Background(), "c1", dest, ContainerCopyArgs{Name: "c1", NoWait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copySource, ok := copied["source"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("the copy wasn't created in the destination project")
+	}
+
+	if copySource["project"] != "src" || copySource["source"] != "c1" {
+		t.Errorf("unexpected copy source: %v", copySource)
+	}
+
+	// Within the same project, the source can't be copied over itself
+	_, err = source.CopyContainer(context.Background(), "c1", source, ContainerCopyArgs{Name: "c1", NoWait: true})
+	if err == nil {
+		t.Errorf("copying a container over itself succeeded")
+	}
+}
+
+func TestCopyContainerNoAddresses(t *testing.T) {
+	migrations := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"api_extensions": [], "environment": {"addresses": []}}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/containers/c1":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1", "architecture": "x86_64", "config": {}, "devices": {}, "profiles": []}}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers/c1":
+			migrations++
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer server.Close()
+
+	// A local daemon without core.https_address has no address to offer
+	source := &Client{Name: "local", Transport: "unix", BaseURL: server.URL, Remote: &RemoteConfig{}}
+	dest := &Client{Name: "remote", Transport: "https", BaseURL: server.URL, Remote: &RemoteConfig{}}
+
+	_, err := source.CopyContainer(context.Background(), "c1", dest, ContainerCopyArgs{Name: "c1"})
+	if err != errNoAddresses {
+		t.Fatalf("expected %q, got: %v", errNoAddresses, err)
+	}
+
+	if migrations != 0 {
+		t.Errorf("a migration source was created without any address to reach it")
+	}
+}
+
+func TestWaitForSuccessInterval(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/operations/done":
+			polls++
+			status := "Running"
+			code := 103
+			if polls == 3 {
+				status = "Success"
+				code = 200
+			}
+
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "done", "status": "%s", "status_code": %d}}`, status, code)
+		case "/1.0/operations/failed":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "failed", "status": "Failure", "status_code": 400, "err": "copy failed"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Name: "remote", BaseURL: server.URL, Remote: &RemoteConfig{}}
+
+	err := c.WaitForSuccessInterval(context.Background(), "/1.0/operations/done", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if polls != 3 {
+		t.Errorf("the operation was polled %d times", polls)
+	}
+
+	err = c.WaitForSuccessInterval(context.Background(), "/1.0/operations/failed", time.Millisecond)
+	if err == nil || err.Error() != "copy failed" {
+		t.Errorf("expected the error of the operation, got: %v", err)
+	}
+}
+
+func TestTargetError(t *testing.T) {
+	err := targetError(fmt.Errorf("disk full"), true)
+	if err.Error() != "Migration failed on target host: disk full (the source finished sending the container)" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err = targetError(fmt.Errorf("bad handshake"), false)
+	if err.Error() != "Migration failed on target host: bad handshake (the source didn't finish sending the container)" {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestMigrationAddresses(t *testing.T) {
+	addresses := []string{"10.0.0.1:8443", "10.1.0.1:8443"}
+
+	result := migrationAddresses(addresses, "")
+	if !reflect.DeepEqual(result, addresses) {
+		t.Errorf("addresses changed without a migration address: %v", result)
+	}
+
+	result = migrationAddresses(addresses, "10.1.0.1:8443")
+	expected := []string{"10.1.0.1:8443", "10.0.0.1:8443"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	result = migrationAddresses(nil, "192.168.0.1:8443")
+	expected = []string{"192.168.0.1:8443"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+}
+
+func TestCopyContainerRetryTransfer(t *testing.T) {
+	sourceOps := 0
+	cancelled := []string{}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"api_extensions": [], "environment": {"addresses": ["127.0.0.1:8443"]}}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/containers/c1":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1", "architecture": "x86_64", "config": {}, "devices": {}, "profiles": []}}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers/c1":
+			sourceOps++
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/src%d", "metadata": {"id": "src%d", "metadata": {"control": "a", "fs": "b"}}}`, sourceOps, sourceOps)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/wait"):
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		case r.Method == "DELETE":
+			cancelled = append(cancelled, r.URL.Path)
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer source.Close()
+
+	destOps := 0
+	refuse := false
+	exists := false
+	deleted := 0
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0/profiles":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": []}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers" && refuse:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"type": "error", "error": "invalid config", "error_code": 400}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers" && exists:
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"type": "error", "error": "Container 'c1' already exists", "error_code": 409}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers":
+			exists = true
+			destOps++
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/dst%d", "metadata": {"id": "dst%d"}}`, destOps, destOps)
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/dst1/wait":
+			// The destination fails to connect to the source the first
+			// time, leaving the container it created behind
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "dst1", "status": "Failure", "status_code": 400, "err": "Error transferring container data: websocket: bad handshake", "resources": {"containers": ["/1.0/containers/c1"]}}}`)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/wait"):
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		case r.Method == "DELETE" && r.URL.Path == "/1.0/containers/c1":
+			exists = false
+			deleted++
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/delete", "metadata": {"id": "delete"}}`)
+		case r.Method == "DELETE":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer dest.Close()
+
+	c := &Client{Name: "local", Transport: "unix", BaseURL: source.URL, Remote: &RemoteConfig{}}
+	d := &Client{Name: "remote", Transport: "https", BaseURL: dest.URL, Remote: &RemoteConfig{}}
+
+	resp, err := c.CopyContainer(context.Background(), "c1", d, ContainerCopyArgs{Name: "c1", Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Operation != "/1.0/operations/dst2" {
+		t.Errorf("expected the second transfer to be returned, got %s", resp.Operation)
+	}
+
+	if sourceOps != 2 || destOps != 2 {
+		t.Errorf("expected the transfer to be started over once, got %d source and %d destination operations", sourceOps, destOps)
+	}
+
+	if !reflect.DeepEqual(cancelled, []string{"/1.0/operations/src1"}) {
+		t.Errorf("expected the first source operation to be cancelled, got %v", cancelled)
+	}
+
+	if deleted != 1 {
+		t.Errorf("expected the container of the first transfer to be deleted, got %d deletions", deleted)
+	}
+
+	// Without retries the interrupted transfer fails the copy
+	sourceOps = 0
+	destOps = 0
+	exists = false
+	_, err = c.CopyContainer(context.Background(), "c1", d, ContainerCopyArgs{Name: "c1"})
+	_, ok := err.(MigrationError)
+	if !ok {
+		t.Errorf("expected the interrupted transfer to fail the migration, got: %v", err)
+	}
+
+	// A migration the destination refuses never started
+	exists = false
+	refuse = true
+	_, err = c.CopyContainer(context.Background(), "c1", d, ContainerCopyArgs{Name: "c1"})
+	_, ok = err.(MigrationError)
+	if err == nil || ok {
+		t.Errorf("expected the refusal of the destination, got: %v", err)
+	}
+
+	// An existing container is reported as such
+	exists = true
+	refuse = false
+	_, err = c.CopyContainer(context.Background(), "c1", d, ContainerCopyArgs{Name: "c1"})
+	if err != LXDErrors[http.StatusConflict] {
+		t.Errorf("expected the name to be taken, got: %v", err)
+	}
+}
+
+func TestStoragePoolVolumeCopy(t *testing.T) {
+	cancelled := 0
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"api_extensions": [], "environment": {"addresses": ["10.0.0.1:8443", "10.0.0.2:8443"]}}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/storage-pools/default/volumes/custom/vol1":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "vol1", "type": "custom", "config": {"size": "1GB"}}}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/storage-pools/default/volumes/custom/vol1":
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/src", "metadata": {"id": "src", "metadata": {"fs": "a"}}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/src/wait":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		case r.Method == "DELETE":
+			cancelled++
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer source.Close()
+
+	requests := []api.StorageVolumesPost{}
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/1.0/storage-pools/other/volumes/custom":
+			req := api.StorageVolumesPost{}
+			json.NewDecoder(r.Body).Decode(&req)
+			requests = append(requests, req)
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/dst%d", "metadata": {"id": "dst%d"}}`, len(requests), len(requests))
+		case r.Method == "GET" && r.URL.Path == "/1.0/operations/dst1/wait":
+			// The first address of the source isn't reachable
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"id": "dst1", "status": "Failure", "status_code": 400, "err": "Error transferring storage volume data: dial tcp 10.0.0.1:8443: connection refused"}}`)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/wait"):
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer dest.Close()
+
+	c := &Client{Name: "local", Transport: "unix", BaseURL: source.URL, Remote: &RemoteConfig{}}
+	d := &Client{Name: "remote", Transport: "https", BaseURL: dest.URL, Remote: &RemoteConfig{}}
+
+	err := c.StoragePoolVolumeCopy(context.Background(), "default", "vol1", d, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("expected the second address to be tried, got %d requests", len(requests))
+	}
+
+	req := requests[1]
+	if req.Name != "vol1" || req.Type != "custom" || req.Config["size"] != "1GB" {
+		t.Errorf("expected the volume to be created as on the source, got %+v", req)
+	}
+
+	if req.Source.Type != "migration" || req.Source.Operation != "https://10.0.0.2:8443/1.0/operations/src" || req.Source.Websockets["fs"] != "a" {
+		t.Errorf("expected the volume to be pulled from the second address, got %+v", req.Source)
+	}
+
+	if cancelled != 0 {
+		t.Errorf("expected the source operation to be kept, got %d cancellations", cancelled)
+	}
+}
+
+func TestCopyContainerRefreshSource(t *testing.T) {
+	requests := []api.ContainerPost{}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"api_extensions": [], "environment": {"addresses": ["127.0.0.1:8443"]}}}`)
+		case r.Method == "GET" && r.URL.Path == "/1.0/containers/c1":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1", "architecture": "x86_64", "config": {}, "devices": {}, "profiles": []}}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers/c1":
+			req := api.ContainerPost{}
+			json.NewDecoder(r.Body).Decode(&req)
+			requests = append(requests, req)
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/src", "metadata": {"id": "src", "metadata": {"control": "a", "fs": "b"}}}`)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/wait"):
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer source.Close()
+
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/1.0/profiles":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": []}`)
+		case r.Method == "POST" && r.URL.Path == "/1.0/containers":
+			fmt.Fprintf(w, `{"type": "async", "status": "Operation created", "status_code": 100, "operation": "/1.0/operations/dst", "metadata": {"id": "dst"}}`)
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/wait"):
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"status": "Success", "status_code": 200}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer dest.Close()
+
+	c := &Client{Name: "local", Transport: "unix", BaseURL: source.URL, Remote: &RemoteConfig{}}
+	d := &Client{Name: "remote", Transport: "https", BaseURL: dest.URL, Remote: &RemoteConfig{}}
+
+	for _, refresh := range []bool{true, false} {
+		requests = nil
+		_, err := c.CopyContainer(context.Background(), "c1", d, ContainerCopyArgs{Name: "c1", Refresh: refresh})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The source needs to know to skip the snapshots of the destination
+		if len(requests) != 1 || !requests[0].Migration || requests[0].Refresh != refresh {
+			t.Errorf("expected the source to be set up with refresh=%v, got %+v", refresh, requests)
+		}
+	}
+}
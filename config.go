@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -44,6 +45,13 @@ type RemoteConfig struct {
 	Public   bool   `yaml:"public"`
 	Protocol string `yaml:"protocol,omitempty"`
 	Static   bool   `yaml:"-"`
+
+	// Profiles added to containers copied to this remote
+	Profiles []string `yaml:"profiles,omitempty"`
+
+	// Address ("<host>:<port>") the other servers migrate containers from,
+	// in place of the addresses the remote reports
+	MigrationAddress string `yaml:"migration_address,omitempty"`
 }
 
 var LocalRemote = RemoteConfig{
@@ -155,6 +163,10 @@ func SaveConfig(c *Config, fname string) error {
 }
 
 func (c *Config) ParseRemoteAndContainer(raw string) (string, string) {
+	if strings.HasPrefix(raw, "unix://") {
+		return parseUnixRemote(raw)
+	}
+
 	result := strings.SplitN(raw, ":", 2)
 	if len(result) == 1 {
 		return c.DefaultRemote, result[0]
@@ -163,9 +175,54 @@ func (c *Config) ParseRemoteAndContainer(raw string) (string, string) {
 }
 
 func (c *Config) ParseRemote(raw string) string {
+	if strings.HasPrefix(raw, "unix://") {
+		remote, _ := parseUnixRemote(raw)
+		return remote
+	}
+
 	return strings.SplitN(raw, ":", 2)[0]
 }
 
+// parseUnixRemote splits an inline "unix://<path>[:<name>]" remote, the
+// socket path being everything up to the last colon.
+func parseUnixRemote(raw string) (string, string) {
+	i := strings.LastIndex(raw, ":")
+	if i < len("unix://") {
+		return raw, ""
+	}
+
+	return raw[:i], raw[i+1:]
+}
+
+// ResolveRemote returns the configuration of a remote without connecting to
+// it, the default remote being used for an empty name. Inline unix sockets
+// resolve to themselves.
+func (c *Config) ResolveRemote(name string) (RemoteConfig, error) {
+	if name == "" {
+		name = c.DefaultRemote
+		if name == "" {
+			name = "local"
+		}
+	}
+
+	r, ok := c.Remotes[name]
+	if ok {
+		return r, nil
+	}
+
+	if strings.HasPrefix(name, "unix://") {
+		return RemoteConfig{Addr: name}, nil
+	}
+
+	known := []string{}
+	for remote := range c.Remotes {
+		known = append(known, remote)
+	}
+	sort.Strings(known)
+
+	return RemoteConfig{}, fmt.Errorf("unknown remote: %s (known remotes: %s)", name, strings.Join(known, ", "))
+}
+
 func (c *Config) ConfigPath(file string) string {
 	return path.Join(c.ConfigDir, file)
 }
@@ -0,0 +1,91 @@
+package lxd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRemoteAndContainer(t *testing.T) {
+	config := &Config{DefaultRemote: "local"}
+
+	tests := []struct {
+		raw       string
+		remote    string
+		container string
+	}{
+		{"c1", "local", "c1"},
+		{"l2:c1", "l2", "c1"},
+		{"l2:", "l2", ""},
+		{"l2:c1/snap0", "l2", "c1/snap0"},
+		{"unix:///a/lxd.sock:c1", "unix:///a/lxd.sock", "c1"},
+		{"unix:///a/lxd.sock:", "unix:///a/lxd.sock", ""},
+		{"unix:///a/lxd.sock", "unix:///a/lxd.sock", ""},
+		{"unix://", "unix://", ""},
+	}
+
+	for _, test := range tests {
+		remote, container := config.ParseRemoteAndContainer(test.raw)
+		if remote != test.remote || container != test.container {
+			t.Errorf("%q: got (%q, %q), expected (%q, %q)", test.raw, remote, container, test.remote, test.container)
+		}
+
+		// ParseRemote takes a bare name as the remote
+		if !strings.Contains(test.raw, ":") {
+			continue
+		}
+
+		remote = config.ParseRemote(test.raw)
+		if remote != test.remote {
+			t.Errorf("%q: got remote %q, expected %q", test.raw, remote, test.remote)
+		}
+	}
+}
+
+func TestResolveRemote(t *testing.T) {
+	config := &Config{
+		DefaultRemote: "l2",
+		Remotes: map[string]RemoteConfig{
+			"local": LocalRemote,
+			"l2":    {Addr: "https://10.0.0.2:8443"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		addr string
+		err  string
+	}{
+		{"local", "unix://", ""},
+		{"l2", "https://10.0.0.2:8443", ""},
+		{"", "https://10.0.0.2:8443", ""},
+		{"unix:///a/lxd.sock", "unix:///a/lxd.sock", ""},
+		{"l3", "", "unknown remote: l3 (known remotes: l2, local)"},
+	}
+
+	for _, test := range tests {
+		remote, err := config.ResolveRemote(test.name)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, expected %q", test.name, err, test.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if remote.Addr != test.addr {
+			t.Errorf("%q: got %q, expected %q", test.name, remote.Addr, test.addr)
+		}
+	}
+
+	// Without a default remote, the local one is used
+	config.DefaultRemote = ""
+	remote, err := config.ResolveRemote("")
+	if err != nil || remote.Addr != "unix://" {
+		t.Errorf("no default remote: got (%v, %v)", remote, err)
+	}
+}
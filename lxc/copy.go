@@ -1,21 +1,367 @@
 package main
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
 
 	"github.com/lxc/lxd"
 	"github.com/lxc/lxd/shared"
 	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/gnuflag"
 	"github.com/lxc/lxd/shared/i18n"
+	"github.com/lxc/lxd/shared/logger"
+	"github.com/lxc/lxd/shared/termios"
 )
 
 type copyCmd struct {
-	profArgs      profileList
-	confArgs      configList
-	ephem         bool
-	containerOnly bool
+	profArgs           profileList
+	confArgs           configList
+	ephem              bool
+	containerOnly      bool
+	refresh            bool
+	target             string
+	storagePool        string
+	mode               string
+	preserveTimestamps bool
+	configFile         string
+	fileConfig         map[string]string
+	format             string
+	retries            int
+	stateful           bool
+	limit              string
+	bwlimit            string
+	noProfiles         bool
+	instanceType       string
+	instanceConfig     map[string]string
+	withVolumes        bool
+	dryRun             bool
+	unsetKeys          unsetList
+	timeout            time.Duration
+	printName          bool
+	verify             bool
+	snapshotRename     string
+	allowInconsistent  bool
+	strictArch         bool
+	targetProject      string
+	sameHostOptimize   bool
+	keepOnFail         bool
+	specFile           string
+	spec               *api.ContainerPut
+	profileFrom        string
+	deviceArgs         deviceList
+	compression        string
+	protocol           string
+	fromSnapshot       string
+	ignoreMissing      bool
+	profilesIgnoreCase bool
+	description        optionalString
+	toImage            bool
+	imageAliases       aliasList
+	wait               bool
+	sourceOperation    string
+	statefulTransfer   bool
+	certFile           string
+	keyFile            string
+	clientCert         string
+	clientKey          string
+	rootfsOnly         bool
+	batchFile          string
+	parallel           int
+	autoName           bool
+	targetSpec         string
+	followEvents       bool
+	preHook            string
+	postHook           string
+	snapshots          snapshotList
+	excludes           excludeList
+	configPreserve     preserveList
+	keepVolatile       bool
+	mapUIDs            idmapList
+	mapGIDs            idmapList
+	replace            bool
+	backup             bool
+	sourceSnapshotOnly bool
+	timeoutIdle        time.Duration
+	expiry             string
+	expiryDate         time.Time
+	profPrepend        profileList
+	quiet              bool
+	toFile             string
+	fromFile           string
+	project            string
+	start              bool
+	network            string
+	waitInterval       time.Duration
+	manifest           string
+	yes                bool
+}
+
+// Exit codes of the failed copies
+const (
+	copyExitProfiles     = 2
+	copyExitArchitecture = 3
+	copyExitTransfer     = 4
+	copyExitHook         = 5
+	copyExitServer       = 6
+)
+
+// Bounds of --wait-interval, below them the requests alone slow the servers
+// down and above them a copy may be reported done long after it was
+const (
+	copyWaitIntervalMin = 100 * time.Millisecond
+	copyWaitIntervalMax = time.Minute
+)
+
+// How many more names --auto-name tries when the picked one got taken in the
+// meantime, and how many suffixes it checks to find a free one
+const (
+	copyAutoNameRetries = 3
+	copyAutoNameMax     = 100
+)
+
+type unsetList []string
+
+func (f *unsetList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *unsetList) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf(i18n.G("Invalid configuration key"))
+	}
+
+	*f = append(*f, value)
+	return nil
+}
+
+type snapshotList []string
+
+func (f *snapshotList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *snapshotList) Set(value string) error {
+	if value == "" || strings.Contains(value, shared.SnapshotDelimiter) {
+		return fmt.Errorf(i18n.G("Invalid snapshot name '%s'"), value)
+	}
+
+	*f = append(*f, value)
+	return nil
+}
+
+type excludeList []string
+
+func (f *excludeList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *excludeList) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf(i18n.G("Invalid exclude pattern"))
+	}
+
+	*f = append(*f, value)
+	return nil
+}
+
+type preserveList []string
+
+func (f *preserveList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *preserveList) Set(value string) error {
+	if !strings.HasPrefix(value, "volatile.") {
+		return fmt.Errorf(i18n.G("Only volatile keys can be preserved, '%s' isn't one"), value)
+	}
+
+	*f = append(*f, value)
+	return nil
+}
+
+type idmapList []string
+
+func (f *idmapList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *idmapList) Set(value string) error {
+	entry, err := parseIdmapEntry(value)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, entry)
+	return nil
+}
+
+// parseIdmapEntry turns a <host>[-<end>]:<container>[-<end>] mapping into the
+// "<host> <container>" form used in raw.idmap, both ranges being of the same
+// size
+func parseIdmapEntry(value string) (string, error) {
+	invalid := fmt.Errorf(i18n.G("Invalid id mapping '%s', must be <host>[-<end>]:<container>[-<end>]"), value)
+
+	getRange := func(r string) (int64, error) {
+		fields := strings.Split(r, "-")
+		if len(fields) > 2 {
+			return -1, invalid
+		}
+
+		base, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || base < 0 {
+			return -1, invalid
+		}
+
+		if len(fields) == 1 {
+			return 1, nil
+		}
+
+		end, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || end < base {
+			return -1, invalid
+		}
+
+		return end - base + 1, nil
+	}
+
+	fields := strings.Split(value, ":")
+	if len(fields) != 2 {
+		return "", invalid
+	}
+
+	hostSize, err := getRange(fields[0])
+	if err != nil {
+		return "", err
+	}
+
+	containerSize, err := getRange(fields[1])
+	if err != nil {
+		return "", err
+	}
+
+	if hostSize != containerSize {
+		return "", fmt.Errorf(i18n.G("The ranges of the id mapping '%s' aren't of the same size"), value)
+	}
+
+	return fmt.Sprintf("%s %s", fields[0], fields[1]), nil
+}
+
+type deviceList []string
+
+func (f *deviceList) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *deviceList) Set(value string) error {
+	_, _, err := parseDeviceOverride(value)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, value)
+	return nil
+}
+
+// optionalString is a string flag which remembers whether it was passed, to
+// tell an empty value from a missing one.
+type optionalString struct {
+	value string
+	set   bool
+}
+
+func (f *optionalString) String() string {
+	return f.value
+}
+
+func (f *optionalString) Set(value string) error {
+	f.value = value
+	f.set = true
+	return nil
+}
+
+type copyResult struct {
+	Container string  `json:"container,omitempty"`
+	Image     string  `json:"image,omitempty"`
+	Source    string  `json:"source"`
+	Migrated  bool    `json:"migrated"`
+	Duration  float64 `json:"duration"`
+	Bytes     int64   `json:"bytes,omitempty"`
+	Stateful  bool    `json:"stateful"`
+	Started   bool    `json:"started,omitempty"`
+	Operation string  `json:"operation,omitempty"`
+	File      string  `json:"file,omitempty"`
+}
+
+// copyManifest is the record of a copy written by --manifest
+type copyManifest struct {
+	Source          string            `json:"source"`
+	Destination     string            `json:"destination"`
+	Migrated        bool              `json:"migrated"`
+	Profiles        []string          `json:"profiles"`
+	Config          map[string]string `json:"config"`
+	ConfigRemoved   []string          `json:"config_removed"`
+	BaseImage       string            `json:"base_image,omitempty"`
+	Bytes           int64             `json:"bytes"`
+	StartedAt       time.Time         `json:"started_at"`
+	CompletedAt     time.Time         `json:"completed_at"`
+	SourceOperation string            `json:"source_operation,omitempty"`
+	Operation       string            `json:"operation"`
+}
+
+// copyTargetSpec is the --target-spec JSON, the matching flags override its
+// fields
+type copyTargetSpec struct {
+	Project      string `json:"project"`
+	Pool         string `json:"pool"`
+	Member       string `json:"member"`
+	InstanceType string `json:"instance_type"`
+}
+
+// copyBatchEntry is a copy listed in a --batch file
+type copyBatchEntry struct {
+	Source   string            `yaml:"source"`
+	Dest     string            `yaml:"dest"`
+	Profiles []string          `yaml:"profiles"`
+	Config   map[string]string `yaml:"config"`
+}
+
+// copyStartedResult describes a copy started with --wait=false
+type copyStartedResult struct {
+	Source          string `json:"source"`
+	Migrated        bool   `json:"migrated"`
+	Operation       string `json:"operation"`
+	SourceOperation string `json:"source_operation,omitempty"`
+}
+
+// copyStats describes how long a copy took, how much data it transferred and
+// whether the runtime state of the container was part of it
+type copyStats struct {
+	duration time.Duration
+	bytes    int64
+	stateful bool
+	started  bool
 }
 
 func (c *copyCmd) showByDefault() bool {
@@ -24,9 +370,303 @@ func (c *copyCmd) showByDefault() bool {
 
 func (c *copyCmd) usage() string {
 	return i18n.G(
-		`Usage: lxc copy [<remote>:]<source>[/<snapshot>] [[<remote>:]<destination>] [--ephemeral|e] [--profile|-p <profile>...] [--config|-c <key=value>...] [--container-only]
+		`Usage: lxc copy [<remote>:]<source>[/<snapshot>] [[<remote>:]<destination>] [--ephemeral|e[=false]] [--profile|-p <profile>...] [--profile-prepend <profile>...] [--config|-c <key=value>...] [--container-only] [--refresh] [--target <member>] [--storage|-s <pool>] [--network <network>] [--mode <pull|push|relay>] [--preserve-timestamps] [--config-from-file <file>] [--format json] [--manifest <file>] [--quiet|-q] [--retries <count>] [--stateful] [--limit <rate>] [--no-profiles] [--instance-type <type>] [--with-volumes] [--dry-run] [--unset <key>...] [--timeout <duration>] [--timeout-idle <duration>] [--wait-interval <duration>] [--print-name] [--verify] [--snapshot-rename <pattern>] [--allow-inconsistent] [--strict-arch] [--project <project>] [--target-project <project>] [--same-host-optimize] [--keep-on-fail] [--spec <file>] [--profile-from [<remote>:]<container>] [--device <name>,<key>=<value>...] [--compression <none|lz4|zstd|gzip>] [--protocol <rsync|btrfs|zfs>] [--ignore-missing-profiles] [--profiles-ignore-case] [--description <text>] [--to-image [--alias <alias>...]] [--wait=false] [--cert <file> --key <file>] [--rootfs-only] [--from-snapshot <latest|oldest>] [--source-snapshot-only] [--auto-name] [--target-spec <json>] [--follow-events] [--pre-hook <command>] [--post-hook <command>] [--snapshot <name>...] [--refresh --exclude <path>...] [--config-preserve <prefix>...] [--keep-volatile] [--map-uid <host>:<container>...] [--map-gid <host>:<container>...] [--replace [--backup] [--yes|-y]] [--expiry <duration|date>] [--start] [--to-file <file>]
+       lxc copy --from-file <file> [[<remote>:]<destination>]
+       lxc copy --batch <file> [--parallel <count>] [<options>...]
+
+Copy containers within or in between LXD instances.
+
+Multiple sources may be given when the destination is a remote
+("<remote>:"), each container then keeps its name. Sources can also be glob
+patterns matching the names of the containers of their remote, e.g.
+lxc copy 'web-*' host2:, the status of each copy is then shown once they're
+all done.
+
+A source of "<container>/@latest" or "<container>/@oldest" copies the most
+recent or the oldest snapshot of the container, as does --from-snapshot
+latest or oldest with a container as the source. --source-snapshot-only is
+the same as --from-snapshot latest, the new container then gets the state of
+the last snapshot rather than the live filesystem of the source, which may
+be changing while it's copied. Unlike --container-only, which copies the live
+filesystem without the snapshots, none of the live filesystem is copied.
+
+The new container is ephemeral when its source is, --ephemeral makes it
+ephemeral and --ephemeral=false persistent.
+
+--expiry has the destination stop and delete the new container after a
+duration (e.g. 12h or 7d) or on a date (YYYY-MM-DD or RFC3339), by setting
+its "expiry" config key. The destination must support container expiry.
+Without it, the new container never expires even if the source does.
+
+When --refresh is passed and the destination container already exists, only
+the differences are transferred instead of failing. An interrupted refresh
+can be resumed by running it again.
+
+--exclude skips the paths matching an rsync pattern when refreshing, e.g.
+/var/cache for that directory of the container or *.tmp for every file with
+that extension. The excluded paths are left as they are on the destination.
+Excludes only affect the filesystem, the configuration is always copied.
+
+--target places the new container on a specific member of a clustered
+destination.
+
+--target-spec sets the project, storage pool, cluster member and instance
+type of the new container at once, e.g. '{"project": "dev", "pool": "ssd",
+"member": "node1", "instance_type": "c2-m4"}'. --target-project, --storage,
+--target and --instance-type override the matching fields.
+
+--mode selects how the data is transferred between two remotes, either pulled
+by the destination (default), pushed by the source when the destination can't
+reach it or relayed through the client when the two remotes can't reach each
+other. Snapshots can't be pushed.
+
+--config-from-file reads config keys from a YAML file, keys passed with
+--config take precedence over the ones from the file.
+
+The volatile keys of the source are dropped, except for the ones starting
+with a --config-preserve prefix, e.g. volatile.eth0.hwaddr to keep the MAC
+address of the container. --keep-volatile keeps all of them, making an
+identical clone which conflicts with its source on the same network.
+
+--map-uid and --map-gid map host uids and gids to the ones of the new
+container, e.g. --map-uid 1000:1000 or --map-uid 1000-1999:0-999, by adding
+them to its raw.idmap. The destination then shifts the ownership of the
+files to the new map when the container starts. Privileged containers
+(security.privileged=true) don't use an idmap, so the options are refused
+for them.
+
+--format json prints the result of the copy as a JSON object.
+
+--manifest writes a JSON record of the copy to the file once it succeeded,
+with the source and the new container, its profiles, the config keys set or
+removed by the copy, the base image, the amount of data transferred, when
+the copy started and completed and the operations involved. It can be used
+along with --format json and only when copying a single container.
+
+--quiet prints nothing on standard output, only errors and warnings are
+shown on standard error. It takes precedence over --format json, which then
+prints nothing either, while --verbose still logs to standard error.
+
+--verbose shows which source address is used for the transfer along with
+the source and destination operations, or the operation of a local copy.
+When migrating, it also shows the base image fingerprint recorded on the
+destination, or that the container has none. The JSON result also has the
+operation which created the new container.
+
+--retries sets how many more times to try each source address when the
+connection fails, waiting twice as long between each attempt. A transfer
+interrupted by the network is started over as many times.
+
+The destination migrates the container from the migration_address of the
+source remote in config.yml when it has one, e.g. a dedicated storage
+network, and from the other addresses of the source when it can't reach it.
+
+--stateful also transfers the runtime state of a running container, this
+requires CRIU on both ends. Whether the state was transferred is shown once
+the copy is done, with a warning when the container stopped in the meantime
+and only its disk was copied.
+
+--limit caps the transfer rate between remotes, either in bytes (e.g. 50MB)
+or in bits (e.g. 400Mbit) per second.
+
+The profiles listed under "profiles" for the destination remote in the
+client configuration are added to the copy.
+
+--profile adds profiles after the ones of the source, so that their config
+takes precedence. --profile-prepend adds them before the ones of the source
+instead, which then take precedence over them.
+
+--no-profiles creates the copy without the profiles of the source or the
+ones of the destination remote, only those passed with --profile are applied.
+The root disk must then come from the container's own devices or from one of
+those profiles.
+
+--instance-type sets the CPU and memory limits of the copy from a type of the
+form c<CPU>-m<RAM in GB>, e.g. c2-m4. Keys passed with --config take
+precedence.
+
+Custom storage volumes attached to the container aren't copied to another
+remote unless --with-volumes is passed, which copies them to the pool of the
+same name on the destination before the container.
+
+--dry-run checks that the copy can be done and shows what would be done
+without copying anything.
+
+--unset removes a config key from the copy, a trailing "*" removes all the
+keys starting with what comes before it. It's only supported between
+different remotes, a local copy always gets all the keys of the source.
+
+--timeout gives up on a copy between remotes which didn't complete in time
+(e.g. 30m), LXD_COPY_TIMEOUT is used when it isn't passed. By default, there's
+no time limit. This includes checking the profiles of the destination before
+the transfer, which is reported when the destination is slow to answer.
+
+--timeout-idle gives up on a transfer between remotes when the destination
+received nothing for that long (e.g. 10m), whatever the time already spent
+on the copy. This catches transfers stalled on a flaky link. It's counted from
+the first data received and needs a destination reporting it.
+
+--wait-interval checks whether the copy completed at that interval instead
+of having the servers report it, e.g. 500ms for many small copies or 30s to
+keep the requests down on a slow link. It must be between 100ms and 1m.
+
+--print-name prints just the name of the new container once it's created.
+
+--verify compares the checksums of all files in the source and the new
+container once the copy is done. This requires a stopped source container
+and reads every file on both sides, so it can take a while. On mismatch the
+new container is left in place for inspection.
+
+--snapshot-rename renames the snapshots of the new container following a
+pattern, "{name}" is replaced by the name of the snapshot and "{date}" by the
+date of the copy (YYYYMMDD), e.g. "{date}-{name}".
 
-Copy containers within or in between LXD instances.`)
+--allow-inconsistent lets a stateless copy of a running container between
+remotes go through even when files vanish while they're being transferred.
+The copy then contains the filesystem as it was at different points in time
+and may be inconsistent, e.g. for databases. Stop the container or use
+--stateful when that matters.
+
+A warning is shown when the destination remote doesn't support the
+architecture of the container, --strict-arch refuses such copies instead.
+
+--project takes the source container from a project of the source remote
+and --target-project creates the new container in a project of the
+destination remote, both require remotes with projects support. A local
+copy goes to the project of the source unless --target-project is passed,
+and may then keep the name of the source.
+
+A unix socket can be used instead of a remote, e.g.
+"unix:///var/lib/lxd/unix.socket:c1", copies between two sockets are done as
+between two remotes.
+
+--same-host-optimize does a local copy instead of a migration when two
+different remotes point to the same server.
+
+When a copy between remotes fails, the partially copied container is deleted
+unless --keep-on-fail is passed or the copy was a --refresh, which can be
+resumed. An existing destination container is never deleted, and
+--keep-on-fail refuses to copy over one.
+
+--spec reads a YAML container definition (architecture, config, devices and
+profiles) from a file, or from stdin with "-", and merges it over the one of
+the source. Its config keys and devices replace those of the source and its
+profiles replace the source profiles when set. The other config options
+still apply on top of it.
+
+--profile-from gives the new container the profiles of another container
+instead of those of the source, --profile still adds to them.
+
+--network attaches the network interfaces of the new container to the given
+network of the destination, for when its bridges are named differently. The
+interfaces coming from a profile are overridden by a device of the new
+container.
+
+--device sets keys of a device of the new container, adding the device if
+the source doesn't have it, e.g. --device eth0,parent=br1. A device from the
+profiles is copied into the container with the keys changed.
+
+--compression compresses the transfer between remotes with the given
+algorithm, both remotes need to support it. By default the servers pick how
+to transfer the container.
+
+--protocol forces the protocol used to transfer the filesystem between
+remotes instead of letting the servers negotiate it. "btrfs" and "zfs" need
+both remotes to use that storage, "rsync" works with any of them.
+
+--ignore-missing-profiles drops the profiles which don't exist on the
+destination from the new container with a warning, instead of failing.
+
+--auto-name copies to "<destination>-1", "<destination>-2"... when the
+destination container already exists, instead of failing.
+
+--replace copies over an existing destination container. It's stopped and
+set aside during the copy, then deleted once the copy succeeded, or kept as
+"<destination>-backup-<timestamp>" with --backup. When the copy fails, the
+previous container is put back and started again if it was running.
+Replacing a container without --backup deletes it, which is confirmed first.
+--yes skips the confirmation, it's required when not running in a terminal.
+
+--profiles-ignore-case matches the profiles with the ones of the destination
+regardless of case and surrounding spaces, the new container then uses the
+names of the destination.
+
+--description sets the description of the new container, an empty one
+clears it. By default the description of the source is kept.
+
+--to-file exports the source container or snapshot to a tarball instead of
+copying it, e.g. lxc copy c1/snap0 --to-file c1.tar.gz. The tarball is an
+image, which "lxc image import" imports back. LXD has no container export,
+so the source is published as a temporary image which is downloaded and
+deleted again: the source container must be stopped, unlike its snapshots,
+publishing images must be allowed on the source remote, and the image is
+left behind if lxc is interrupted during the export.
+
+--from-file creates the destination container from a tarball exported with
+--to-file, uploading it to the destination remote, e.g.
+lxc copy --from-file c1.tar.gz remote:c2. --profile, --config and
+--ephemeral apply to the new container.
+
+--to-image publishes the copy as an image of the destination remote instead
+of keeping it as a container, and prints the fingerprint of the image.
+--alias adds aliases to that image.
+
+--wait=false returns as soon as the copy started and prints its operation.
+A copy between remotes has two, the operation of the destination, which
+completes once the container is created, and the one of the source. Both can
+be followed with "lxc monitor <remote>: --type=operation" or waited for
+through GET /1.0/operations/<uuid>/wait. It can't be used with --mode=relay
+as the client then transfers the data.
+
+--cert and --key authenticate to the remotes with the given client
+certificate and key instead of the ones of the client configuration.
+
+--rootfs-only only copies the filesystem, the config keys and devices of the
+source are dropped except for the image properties. The profiles still apply
+unless --no-profiles is passed, as do the other config options. It's only
+supported between different remotes.
+
+--batch runs the copies listed in a YAML file and prints the status of each
+of them. Every entry has a source, an optional
+destination, and profiles and config keys which are applied on top of the
+ones from the command line, e.g.:
+
+- source: c1
+  dest: remote:c1
+  profiles: [web]
+  config:
+    limits.cpu: "2"
+
+--parallel sets how many copies of a batch, or of multiple sources, run at
+the same time (1 by default). A failed copy doesn't stop the other ones and
+the transfer progress isn't shown when copies run in parallel.
+
+--snapshot copies the container with only the given snapshots instead of all
+of them. When the source LXD can't leave the other snapshots out, they're
+deleted from the new container once copied.
+
+--start starts the new container once the copy succeeded, before the
+--post-hook if any, and shows whether it started. The copy is kept when the
+container fails to start, with a warning. By default the new container is
+left stopped.
+
+--pre-hook runs a shell command in the source container before the transfer
+and --post-hook one in the new container once the copy succeeded, e.g. to
+stop and resume a database. --post-hook starts the new container as --start
+does. The copy fails when the command does, the new container is kept when
+the post-hook fails.
+
+--follow-events prints the operations and log messages of the servers about
+the copied containers until the copy is done, showing which step is running.
+
+With --debug, the requests, websockets and operations used by the copy are
+logged, hiding the migration secrets.
+
+A failed copy exits with 2 when some of its profiles don't exist on the
+destination, with 3 when --strict-arch refused the architecture of the
+container, with 4 when the transfer between remotes failed or timed out, with
+5 when a --pre-hook or --post-hook failed and with 6 when a server refused or
+failed the copy otherwise. Other errors exit with 1.`)
 }
 
 func (c *copyCmd) flags() {
@@ -34,265 +674,3352 @@ func (c *copyCmd) flags() {
 	gnuflag.Var(&c.confArgs, "c", i18n.G("Config key/value to apply to the new container"))
 	gnuflag.Var(&c.profArgs, "profile", i18n.G("Profile to apply to the new container"))
 	gnuflag.Var(&c.profArgs, "p", i18n.G("Profile to apply to the new container"))
+	gnuflag.Var(&c.profPrepend, "profile-prepend", i18n.G("Profile to apply to the new container before the other ones"))
 	gnuflag.BoolVar(&c.ephem, "ephemeral", false, i18n.G("Ephemeral container"))
 	gnuflag.BoolVar(&c.ephem, "e", false, i18n.G("Ephemeral container"))
 	gnuflag.BoolVar(&c.containerOnly, "container-only", false, i18n.G("Copy the container without its snapshots"))
+	gnuflag.BoolVar(&c.refresh, "refresh", false, i18n.G("Incrementally update the destination container if it already exists"))
+	gnuflag.StringVar(&c.target, "target", "", i18n.G("Cluster member to place the new container on"))
+	gnuflag.StringVar(&c.storagePool, "storage", "", i18n.G("Storage pool name"))
+	gnuflag.StringVar(&c.storagePool, "s", "", i18n.G("Storage pool name"))
+	gnuflag.StringVar(&c.network, "network", "", i18n.G("Network to attach the network interfaces of the new container to"))
+	gnuflag.StringVar(&c.mode, "mode", "pull", i18n.G("Transfer mode. One of pull (default), push or relay"))
+	gnuflag.BoolVar(&c.preserveTimestamps, "preserve-timestamps", false, i18n.G("Keep the creation and last used dates of the source container"))
+	gnuflag.StringVar(&c.configFile, "config-from-file", "", i18n.G("YAML file of config keys to apply to the new container"))
+	gnuflag.StringVar(&c.format, "format", "", i18n.G("Format (json)"))
+	gnuflag.StringVar(&c.manifest, "manifest", "", i18n.G("File to write a JSON record of the copy to"))
+	gnuflag.BoolVar(&c.quiet, "quiet", false, i18n.G("Don't print anything on success"))
+	gnuflag.BoolVar(&c.quiet, "q", false, i18n.G("Don't print anything on success"))
+	gnuflag.IntVar(&c.retries, "retries", 0, i18n.G("Number of times to retry on connection failures"))
+	gnuflag.BoolVar(&c.stateful, "stateful", false, i18n.G("Copy a running container along with its runtime state"))
+	gnuflag.StringVar(&c.limit, "limit", "", i18n.G("Maximum transfer rate per second between remotes"))
+	gnuflag.BoolVar(&c.noProfiles, "no-profiles", false, i18n.G("Don't apply the profiles of the source container"))
+	gnuflag.StringVar(&c.instanceType, "instance-type", "", i18n.G("Instance type of the new container (c<CPU>-m<RAM in GB>)"))
+	gnuflag.BoolVar(&c.withVolumes, "with-volumes", false, i18n.G("Also copy the attached custom storage volumes"))
+	gnuflag.BoolVar(&c.dryRun, "dry-run", false, i18n.G("Only show what would be copied"))
+	gnuflag.Var(&c.unsetKeys, "unset", i18n.G("Config key to remove from the new container"))
+	gnuflag.DurationVar(&c.timeout, "timeout", 0, i18n.G("Maximum time to wait for the copy to complete"))
+	gnuflag.DurationVar(&c.timeoutIdle, "timeout-idle", 0, i18n.G("Maximum time the transfer may go without progress"))
+	gnuflag.DurationVar(&c.waitInterval, "wait-interval", 0, i18n.G("How often to check whether the copy completed"))
+	gnuflag.StringVar(&c.toFile, "to-file", "", i18n.G("Export the source to a tarball instead of copying it"))
+	gnuflag.StringVar(&c.fromFile, "from-file", "", i18n.G("Create the destination from a tarball exported with --to-file"))
+	gnuflag.StringVar(&c.expiry, "expiry", "", i18n.G("Delete the new container after this duration or on this date"))
+	gnuflag.BoolVar(&c.printName, "print-name", false, i18n.G("Print the name of the new container"))
+	gnuflag.BoolVar(&c.verify, "verify", false, i18n.G("Compare the file checksums of the source and the new container"))
+	gnuflag.StringVar(&c.snapshotRename, "snapshot-rename", "", i18n.G("Pattern used to rename the copied snapshots"))
+	gnuflag.BoolVar(&c.allowInconsistent, "allow-inconsistent", false, i18n.G("Ignore files changing while copying a running container, the copy may be inconsistent"))
+	gnuflag.BoolVar(&c.strictArch, "strict-arch", false, i18n.G("Refuse to copy to a remote which doesn't support the architecture of the container"))
+	gnuflag.StringVar(&c.targetProject, "target-project", "", i18n.G("Project to create the new container in"))
+	gnuflag.BoolVar(&c.start, "start", false, i18n.G("Start the new container once copied"))
+	gnuflag.StringVar(&c.project, "project", "", i18n.G("Project of the source container"))
+	gnuflag.BoolVar(&c.sameHostOptimize, "same-host-optimize", false, i18n.G("Do a local copy when both remotes are the same server"))
+	gnuflag.BoolVar(&c.keepOnFail, "keep-on-fail", false, i18n.G("Keep the partially copied container when the copy fails"))
+	gnuflag.StringVar(&c.profileFrom, "profile-from", "", i18n.G("Container to take the profiles of the new container from"))
+	gnuflag.Var(&c.deviceArgs, "device", i18n.G("Device key/value to apply to the new container (<name>,<key>=<value>)"))
+	gnuflag.StringVar(&c.specFile, "spec", "", i18n.G("YAML container definition to merge over the source (\"-\" for stdin)"))
+	gnuflag.StringVar(&c.batchFile, "batch", "", i18n.G("YAML file listing the copies to do"))
+	gnuflag.IntVar(&c.parallel, "parallel", 1, i18n.G("Number of copies to run at the same time"))
+	gnuflag.BoolVar(&c.rootfsOnly, "rootfs-only", false, i18n.G("Copy only the filesystem, without the config and devices of the source"))
+	gnuflag.StringVar(&c.certFile, "cert", "", i18n.G("Client certificate to use instead of the configured one"))
+	gnuflag.StringVar(&c.keyFile, "key", "", i18n.G("Client key to use instead of the configured one"))
+	gnuflag.BoolVar(&c.wait, "wait", true, i18n.G("Wait for the copy to complete"))
+	gnuflag.BoolVar(&c.toImage, "to-image", false, i18n.G("Publish the copy as an image of the destination"))
+	gnuflag.Var(&c.imageAliases, "alias", i18n.G("Alias of the image published with --to-image"))
+	gnuflag.Var(&c.description, "description", i18n.G("Description of the new container"))
+	gnuflag.BoolVar(&c.ignoreMissing, "ignore-missing-profiles", false, i18n.G("Drop the profiles which don't exist on the destination"))
+	gnuflag.BoolVar(&c.profilesIgnoreCase, "profiles-ignore-case", false, i18n.G("Match the profiles of the destination regardless of case"))
+	gnuflag.StringVar(&c.compression, "compression", "", i18n.G("Compression algorithm of the transfer between remotes (none, lz4, zstd or gzip)"))
+	gnuflag.StringVar(&c.protocol, "protocol", "", i18n.G("Filesystem transfer protocol between remotes (rsync, btrfs or zfs)"))
+	gnuflag.StringVar(&c.fromSnapshot, "from-snapshot", "", i18n.G("Copy the latest or the oldest snapshot of the source"))
+	gnuflag.BoolVar(&c.sourceSnapshotOnly, "source-snapshot-only", false, i18n.G("Copy the latest snapshot of the source instead of its live filesystem"))
+	gnuflag.BoolVar(&c.autoName, "auto-name", false, i18n.G("Add a suffix to the destination name when it's taken"))
+	gnuflag.BoolVar(&c.followEvents, "follow-events", false, i18n.G("Show the server events about the copy"))
+	gnuflag.Var(&c.snapshots, "snapshot", i18n.G("Snapshot to copy along with the container"))
+	gnuflag.Var(&c.configPreserve, "config-preserve", i18n.G("Prefix of the volatile keys to keep"))
+	gnuflag.BoolVar(&c.keepVolatile, "keep-volatile", false, i18n.G("Keep all the volatile keys of the source"))
+	gnuflag.Var(&c.mapUIDs, "map-uid", i18n.G("Uid mapping of the new container (<host>:<container>)"))
+	gnuflag.Var(&c.mapGIDs, "map-gid", i18n.G("Gid mapping of the new container (<host>:<container>)"))
+	gnuflag.BoolVar(&c.replace, "replace", false, i18n.G("Replace the destination container if it already exists"))
+	gnuflag.BoolVar(&c.backup, "backup", false, i18n.G("Keep the replaced container under another name"))
+	gnuflag.BoolVar(&c.yes, "yes", false, i18n.G("Don't ask for confirmation before replacing a container"))
+	gnuflag.BoolVar(&c.yes, "y", false, i18n.G("Don't ask for confirmation before replacing a container"))
+	gnuflag.Var(&c.excludes, "exclude", i18n.G("Path not to transfer when refreshing (rsync pattern)"))
+	gnuflag.StringVar(&c.preHook, "pre-hook", "", i18n.G("Command to run in the source container before the transfer"))
+	gnuflag.StringVar(&c.postHook, "post-hook", "", i18n.G("Command to run in the new container after the copy"))
+	gnuflag.StringVar(&c.targetSpec, "target-spec", "", i18n.G("JSON object with the project, pool, member and instance_type of the new container"))
 }
 
-func (c *copyCmd) copyContainer(config *lxd.Config, sourceResource string, destResource string, keepVolatile bool, ephemeral int, stateful bool, containerOnly bool) error {
+// copyContainer copies a container or snapshot. The new container is
+// ephemeral when the source is unless ephemeral says otherwise.
+func (c *copyCmd) copyContainer(config *lxd.Config, sourceResource string, destResource string, keepVolatile bool, ephemeral *bool, stateful bool, containerOnly bool) error {
 	sourceRemote, sourceName := config.ParseRemoteAndContainer(sourceResource)
-	destRemote, destName := config.ParseRemoteAndContainer(destResource)
+	destRemote, destName := parseCopyDestination(config, destResource, sourceName)
 
 	if sourceName == "" {
 		return fmt.Errorf(i18n.G("you must specify a source container name"))
 	}
 
-	if destName == "" && destResource != "" {
-		destName = sourceName
+	// Catch typos in the remote names before connecting to anything
+	for _, remote := range []string{sourceRemote, destRemote} {
+		_, err := config.ResolveRemote(remote)
+		if err != nil {
+			return err
+		}
 	}
 
-	source, err := lxd.NewClient(config, sourceRemote)
-	if err != nil {
-		return err
+	// A bare name which matches a remote was most likely meant as
+	// "<remote>:", let the user know how to get that.
+	if destResource != "" && !strings.Contains(destResource, ":") {
+		_, ok := config.Remotes[destResource]
+		if ok {
+			fmt.Fprintf(os.Stderr, i18n.G("Copying to container '%s' on remote '%s', use '%s:' to copy to the remote of that name instead")+"\n", destResource, destRemote, destResource)
+		}
 	}
 
-	var status struct {
-		Architecture string
-		Devices      map[string]map[string]string
-		Config       map[string]string
-		Profiles     []string
+	source, err := c.newClient(config, sourceRemote)
+	if err != nil {
+		return err
 	}
 
-	// TODO: presumably we want to do this for copying snapshots too? We
-	// need to think a bit more about how we track the baseImage in the
-	// face of LVM and snapshots in general; this will probably make more
-	// sense once that work is done.
-	baseImage := ""
+	// Trace the requests of the copy with --debug
+	source.SetLogger(logger.Log)
 
-	if !shared.IsSnapshot(sourceName) {
-		result, err := source.ContainerInfo(sourceName)
-		if err != nil {
-			return err
+	if c.project != "" {
+		if !source.HasExtension("projects") {
+			return fmt.Errorf(i18n.G("--project can only be used with remotes supporting projects"))
 		}
 
-		status.Architecture = result.Architecture
-		status.Devices = result.Devices
-		status.Config = result.Config
-		status.Profiles = result.Profiles
+		source = source.UseProject(c.project)
+	}
 
-	} else {
-		result, err := source.SnapshotInfo(sourceName)
-		if err != nil {
-			return err
+	if c.fromSnapshot != "" {
+		if shared.IsSnapshot(sourceName) {
+			return fmt.Errorf(i18n.G("--from-snapshot can't be used with a snapshot as the source"))
 		}
 
-		status.Architecture = result.Architecture
-		status.Devices = result.Devices
-		status.Config = result.Config
-		status.Profiles = result.Profiles
+		sourceName = fmt.Sprintf("%s%s@%s", sourceName, shared.SnapshotDelimiter, c.fromSnapshot)
 	}
 
-	if c.profArgs != nil {
-		status.Profiles = append(status.Profiles, c.profArgs...)
-	}
+	// Pick the snapshot of "<container>/@latest" or "<container>/@oldest"
+	if shared.IsSnapshot(sourceName) {
+		fields := strings.SplitN(sourceName, shared.SnapshotDelimiter, 2)
+		if strings.HasPrefix(fields[1], "@") {
+			snapshots, err := source.ListSnapshots(fields[0])
+			if err != nil {
+				return err
+			}
 
-	if configMap != nil {
-		for key, value := range configMap {
-			status.Config[key] = value
+			sourceName, err = resolveSnapshotSelector(snapshots, fields[1])
+			if err != nil {
+				return fmt.Errorf(i18n.G("Container '%s': %s"), fields[0], err)
+			}
 		}
 	}
 
-	baseImage = status.Config["volatile.base_image"]
-
-	if !keepVolatile {
-		for k := range status.Config {
-			if strings.HasPrefix(k, "volatile") {
-				delete(status.Config, k)
-			}
-		}
+	if c.toFile != "" {
+		return c.exportToFile(source, sourceRemote, sourceName)
 	}
 
-	// Do a local copy if the remotes are the same, otherwise do a migration
-	if sourceRemote == destRemote {
-		if sourceName == destName {
-			return fmt.Errorf(i18n.G("can't copy to the same container name"))
-		}
+	src := copySource{Remote: sourceRemote, Snapshot: shared.IsSnapshot(sourceName)}
 
-		cp, err := source.LocalCopy(sourceName, destName, status.Config, status.Profiles, ephemeral == 1, containerOnly)
+	if !src.Snapshot {
+		result, err := source.ContainerInfo(sourceName)
 		if err != nil {
 			return err
 		}
 
-		err = source.WaitForSuccess(cp.Operation)
+		src.Architecture = result.Architecture
+		src.Devices = result.Devices
+		src.Expanded = result.ExpandedDevices
+		src.Config = result.Config
+		src.Profiles = result.Profiles
+		src.CreatedAt = result.CreatedAt
+		src.LastUsedAt = result.LastUsedAt
+		src.Running = result.StatusCode == api.Running
+		src.Ephemeral = result.Ephemeral
+	} else {
+		result, err := source.SnapshotInfo(sourceName)
 		if err != nil {
 			return err
 		}
 
-		if destResource == "" {
-			op, err := cp.MetadataAsOperation()
-			if err != nil {
-				return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
-			}
-
-			containers, ok := op.Resources["containers"]
-			if !ok || len(containers) == 0 {
-				return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
-			}
+		src.Architecture = result.Architecture
+		src.Devices = result.Devices
+		src.Expanded = result.ExpandedDevices
+		src.Config = result.Config
+		src.Profiles = result.Profiles
+		src.CreatedAt = result.CreationDate
+		src.LastUsedAt = result.LastUsedDate
+		src.Ephemeral = result.Ephemeral
+	}
 
-			fields := strings.Split(containers[0], "/")
-			fmt.Printf(i18n.G("Container name is: %s")+"\n", fields[len(fields)-1])
+	if c.profileFrom != "" {
+		src.ProfilesFrom, err = c.profilesFrom(config, source, sourceRemote)
+		if err != nil {
+			return err
 		}
-
-		return nil
 	}
 
-	dest, err := lxd.NewClient(config, destRemote)
+	plan, err := c.computeCopyPlan(src, copyDestination{Remote: destRemote, Profiles: config.Remotes[destRemote].Profiles}, ephemeral, stateful, containerOnly, keepVolatile)
 	if err != nil {
 		return err
 	}
 
-	sourceProfs := shared.NewStringSet(status.Profiles)
-	destProfs := []string{}
-
-	profiles, err := dest.ListProfiles()
-	if err != nil {
-		return err
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(os.Stderr, warning+"\n")
 	}
 
-	for _, profile := range profiles {
-		destProfs = append(destProfs, profile.Name)
-	}
+	containerOnly = plan.ContainerOnly
 
-	if !sourceProfs.IsSubset(shared.NewStringSet(destProfs)) {
-		return fmt.Errorf(i18n.G("not all the profiles from the source exist on the target"))
-	}
+	if len(c.snapshots) > 0 {
+		if src.Snapshot {
+			return fmt.Errorf(i18n.G("--snapshot can't be used with a snapshot as the source"))
+		}
 
-	if ephemeral == -1 {
-		ct, err := source.ContainerInfo(sourceName)
+		snapshots, err := source.ListSnapshots(sourceName)
 		if err != nil {
 			return err
 		}
 
-		if ct.Ephemeral {
-			ephemeral = 1
-		} else {
-			ephemeral = 0
+		names := []string{}
+		for _, snapshot := range snapshots {
+			fields := strings.SplitN(snapshot.Name, shared.SnapshotDelimiter, 2)
+			names = append(names, fields[len(fields)-1])
 		}
-	}
 
-	sourceWSResponse, err := source.GetMigrationSourceWS(sourceName, stateful, containerOnly)
-	if err != nil {
-		return err
+		missing := shared.NewStringSet(c.snapshots).Difference(shared.NewStringSet(names))
+		if len(missing) > 0 {
+			return fmt.Errorf(i18n.G("The following snapshots don't exist on '%s': %s"), sourceName, strings.Join(missing, ", "))
+		}
 	}
 
-	secrets := map[string]string{}
+	// Work out the new snapshot names upfront so a bad pattern doesn't
+	// leave a half renamed copy behind.
+	var snapshotRenames map[string]string
+	if c.snapshotRename != "" && !containerOnly {
+		snapshots, err := source.ListSnapshots(sourceName)
+		if err != nil {
+			return err
+		}
 
-	op, err := sourceWSResponse.MetadataAsOperation()
-	if err != nil {
-		return err
-	}
+		names := []string{}
+		for _, snapshot := range snapshots {
+			fields := strings.SplitN(snapshot.Name, shared.SnapshotDelimiter, 2)
+			if len(c.snapshots) > 0 && !shared.StringInSlice(fields[len(fields)-1], c.snapshots) {
+				continue
+			}
 
-	for k, v := range op.Metadata {
-		secrets[k] = v.(string)
-	}
+			names = append(names, fields[len(fields)-1])
+		}
 
-	addresses, err := source.Addresses()
-	if err != nil {
-		return err
+		snapshotRenames, err = snapshotRenameMap(c.snapshotRename, names, time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
-	/* Since we're trying a bunch of different network ports that
-	 * may be invalid, we can get "bad handshake" errors when the
-	 * websocket code tries to connect. If the first error is a
-	 * real error, but the subsequent errors are only network
-	 * errors, we should try to report the first real error. Of
-	 * course, if all the errors are websocket errors, let's just
-	 * report that.
-	 */
-	waitchan := make(chan map[int]error, 2)
-	wait := func(cli *lxd.Client, op string, ch chan map[int]error, senderid int) {
-		ch <- map[int]error{senderid: cli.WaitForSuccess(op)}
+	args := lxd.ContainerCopyArgs{
+		Name:             destName,
+		Architecture:     plan.Architecture,
+		Config:           plan.Config,
+		Devices:          plan.Devices,
+		Profiles:         plan.Profiles,
+		Ephemeral:        plan.Ephemeral,
+		ContainerOnly:    plan.ContainerOnly,
+		Stateful:         stateful,
+		KeepVolatile:     keepVolatile,
+		PreserveVolatile: c.configPreserve,
+		Target:           c.target,
+		CreatedAt:        plan.CreatedAt,
+		LastUsedAt:       plan.LastUsedAt,
+		WaitInterval:     c.waitInterval,
 	}
 
-	var migrationErrFromClient error
-	for _, addr := range addresses {
-		var migration *api.Response
+	// Do a local copy if the remotes are the same, otherwise do a migration
+	local := plan.Local
+	dest := c.targetClient(source)
+	destExisted := false
+	copyVolumes := []string{}
 
-		sourceWSUrl := "https://" + addr + sourceWSResponse.Operation
-		migration, migrationErrFromClient = dest.MigrateFrom(destName, sourceWSUrl, source.Certificate, secrets, status.Architecture, status.Config, status.Devices, status.Profiles, baseImage, ephemeral == 1, false, source, sourceWSResponse.Operation, containerOnly)
-		if migrationErrFromClient != nil {
-			continue
+	// Without server side support, the other snapshots are deleted once
+	// copied
+	pruneSnapshots := len(c.snapshots) > 0
+	if !local {
+		dest, err = c.newClient(config, destRemote)
+		if err != nil {
+			return err
 		}
 
-		// If push mode is implemented then MigrateFrom will return a
-		// non-waitable operation. So this needs to be conditionalized
-		// on pull mode.
-		destOpId := 0
-		go wait(dest, migration.Operation, waitchan, destOpId)
-		sourceOpId := 1
-		go wait(source, sourceWSResponse.Operation, waitchan, sourceOpId)
+		dest.SetLogger(logger.Log)
+		dest = c.targetClient(dest)
 
-		var sourceOpErr error
-		var destOpErr error
-		for i := 0; i < cap(waitchan); i++ {
-			tmp := <-waitchan
-			err, ok := tmp[sourceOpId]
-			if ok {
-				sourceOpErr = err
+		// Different remotes may still point to the same server, where a
+		// local copy is much faster. Stateful copies need a migration.
+		if c.sameHostOptimize && !stateful {
+			same, err := sameServer(source, dest)
+			if err != nil {
+				return err
+			}
+
+			if same {
+				fmt.Fprintf(os.Stderr, i18n.G("Remotes '%s' and '%s' are the same server, doing a local copy")+"\n", sourceRemote, destRemote)
+				local = true
+				dest = c.targetClient(source)
 			} else {
-				destOpErr = err
+				fmt.Fprintf(os.Stderr, i18n.G("Remotes '%s' and '%s' are different servers, doing a migration")+"\n", sourceRemote, destRemote)
 			}
 		}
+	}
 
-		if destOpErr != nil {
-			continue
+	if c.profilesIgnoreCase && len(plan.Profiles) > 0 {
+		existing, err := dest.ListProfiles()
+		if err != nil {
+			return err
 		}
 
-		if sourceOpErr != nil {
-			return sourceOpErr
+		names := []string{}
+		for _, profile := range existing {
+			names = append(names, profile.Name)
 		}
 
-		if destResource == "" {
-			op, err := migration.MetadataAsOperation()
-			if err != nil {
-				return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
-			}
+		plan.Profiles = matchProfileNames(plan.Profiles, names)
+		args.Profiles = plan.Profiles
+	}
+
+	if c.ignoreMissing {
+		missing, err := dest.MissingProfiles(plan.Profiles)
+		if err != nil {
+			return err
+		}
 
-			containers, ok := op.Resources["containers"]
-			if !ok || len(containers) == 0 {
-				return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
+		if len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, i18n.G("Dropping the profiles missing on the destination: %s")+"\n", strings.Join(missing, ", "))
+
+			profiles := []string{}
+			for _, profile := range plan.Profiles {
+				if !shared.StringInSlice(profile, missing) {
+					profiles = append(profiles, profile)
+				}
 			}
 
-			fields := strings.Split(containers[0], "/")
-			fmt.Printf(i18n.G("Container name is: %s")+"\n", fields[len(fields)-1])
+			plan.Profiles = profiles
+			args.Profiles = profiles
 		}
-
-		return nil
 	}
 
-	// Check for an error at the source
-	sourceOp, sourceErr := source.GetOperation(sourceWSResponse.Operation)
-	if sourceErr == nil && sourceOp.Err != "" {
-		return fmt.Errorf(i18n.G("Migration failed on source host: %s"), sourceOp.Err)
-	}
+	// Pick a free name instead of failing when the destination exists
+	baseName := destName
+	autoNameIndex := 0
+	if c.autoName && destName != "" {
+		destName, autoNameIndex, err = nextFreeName(dest, baseName, 0)
+		if err != nil {
+			return err
+		}
 
-	// Return the error from destination
-	return fmt.Errorf(i18n.G("Migration failed on target host: %s"), migrationErrFromClient)
-}
+		if destName != baseName {
+			fmt.Fprintf(os.Stderr, i18n.G("Container '%s' already exists, copying to '%s' instead")+"\n", baseName, destName)
+		}
 
-func (c *copyCmd) run(config *lxd.Config, args []string) error {
-	if len(args) < 1 {
+		args.Name = destName
+	}
+
+	if local {
+		if sourceName == destName && c.targetProject == "" {
+			return fmt.Errorf(i18n.G("can't copy to the same container name"))
+		}
+
+		if c.refresh && destName != "" {
+			_, err := dest.ContainerInfo(destName)
+			if err == nil {
+				return fmt.Errorf(i18n.G("Refreshing an existing container is only supported between different remotes"))
+			}
+		}
+
+		if c.limit != "" {
+			return fmt.Errorf(i18n.G("--limit can only be used when copying between different remotes"))
+		}
+
+		// The server adds back the keys and devices of the source missing
+		// from the request, removing them needs a migration
+		if len(c.unsetKeys) > 0 {
+			return fmt.Errorf(i18n.G("--unset can only be used when copying between different remotes"))
+		}
+
+		if c.rootfsOnly {
+			return fmt.Errorf(i18n.G("--rootfs-only can only be used when copying between different remotes"))
+		}
+
+		if c.allowInconsistent {
+			return fmt.Errorf(i18n.G("--allow-inconsistent can only be used when copying between different remotes"))
+		}
+
+		if c.compression != "" {
+			return fmt.Errorf(i18n.G("--compression can only be used when copying between different remotes"))
+		}
+
+		if c.protocol != "" {
+			return fmt.Errorf(i18n.G("--protocol can only be used when copying between different remotes"))
+		}
+
+		if len(c.excludes) > 0 {
+			return fmt.Errorf(i18n.G("--exclude can only be used when copying between different remotes"))
+		}
+
+		if c.target != "" && !source.HasExtension("clustering") {
+			return fmt.Errorf(i18n.G("--target can only be used with clustered remotes"))
+		}
+
+		err = c.checkTargetProject(dest)
+		if err != nil {
+			return err
+		}
+
+		if c.storagePool != "" {
+			_, err := dest.StoragePoolGet(c.storagePool)
+			if err != nil {
+				return fmt.Errorf(i18n.G("Storage pool '%s' isn't available on the destination: %s"), c.storagePool, err)
+			}
+		}
+
+		if c.network != "" {
+			_, err := dest.NetworkGet(c.network)
+			if err != nil {
+				return fmt.Errorf(i18n.G("Network '%s' isn't available on the destination: %s"), c.network, err)
+			}
+		}
+
+		if c.preserveTimestamps && !source.HasExtension("container_copy_timestamps") {
+			return fmt.Errorf(i18n.G("The destination LXD doesn't support preserving timestamps"))
+		}
+
+		if c.dryRun {
+			err := c.checkProfiles(dest, plan.Profiles)
+			if err != nil {
+				return err
+			}
+
+			c.showPlan(sourceRemote, sourceName, destRemote, destName, i18n.G("local copy"), plan.Profiles, plan.Config)
+			return nil
+		}
+	} else {
+		// Remotes which are the same server would have the migration
+		// write over its own source
+		if sameContainer(sourceName, c.project, destName, c.targetProject) {
+			same, err := sameServer(source, dest)
+			if err != nil {
+				return err
+			}
+
+			if same {
+				return fmt.Errorf(i18n.G("Remotes '%s' and '%s' are the same server, can't copy to the same container name"), sourceRemote, destRemote)
+			}
+		}
+
+		if c.target != "" && !dest.HasExtension("clustering") {
+			return fmt.Errorf(i18n.G("--target can only be used with clustered remotes"))
+		}
+
+		err = c.checkTargetProject(dest)
+		if err != nil {
+			return err
+		}
+
+		if c.storagePool != "" {
+			_, err := dest.StoragePoolGet(c.storagePool)
+			if err != nil {
+				return fmt.Errorf(i18n.G("Storage pool '%s' isn't available on the destination: %s"), c.storagePool, err)
+			}
+		}
+
+		if c.network != "" {
+			_, err := dest.NetworkGet(c.network)
+			if err != nil {
+				return fmt.Errorf(i18n.G("Network '%s' isn't available on the destination: %s"), c.network, err)
+			}
+		}
+
+		if c.preserveTimestamps && !dest.HasExtension("container_copy_timestamps") {
+			return fmt.Errorf(i18n.G("The destination LXD doesn't support preserving timestamps"))
+		}
+
+		err = c.checkArchitecture(dest, destRemote, plan.Architecture)
+		if err != nil {
+			return err
+		}
+
+		// Custom volumes live outside of the container and aren't part of
+		// the migration.
+		volumes := customVolumes(plan.Devices)
+		if len(volumes) > 0 && !c.withVolumes {
+			fmt.Fprintf(os.Stderr, i18n.G("The custom storage volumes %s won't be copied, the devices using them may not work on the destination")+"\n", strings.Join(volumes, ", "))
+		} else if len(volumes) > 0 {
+			err := c.checkVolumes(source, dest, volumes)
+			if err != nil {
+				return err
+			}
+
+			copyVolumes = volumes
+		}
+
+		// Only transfer the differences if the destination already exists,
+		// this also resumes an interrupted refresh.
+		if c.refresh && destName != "" {
+			_, err := dest.ContainerInfo(destName)
+			if err == nil {
+				if !dest.HasExtension("container_incremental_copy") {
+					return fmt.Errorf(i18n.G("The destination LXD doesn't support refreshing existing containers"))
+				}
+
+				// Older sources send the snapshots the destination
+				// already has again
+				if !source.HasExtension("container_migration_refresh") {
+					fmt.Fprintf(os.Stderr, i18n.G("The source LXD doesn't support refreshes, all the snapshots are transferred again")+"\n")
+				}
+
+				fmt.Fprintf(os.Stderr, i18n.G("Transferring only the differences to the existing container '%s'")+"\n", destName)
+				args.Refresh = true
+			} else if dest.HasExtension("container_migration_resume") {
+				// Have the destination keep what it got if this fails
+				args.Refresh = true
+			} else {
+				fmt.Fprintf(os.Stderr, i18n.G("The destination LXD can't resume interrupted transfers, doing a full transfer")+"\n")
+			}
+		}
+
+		switch c.mode {
+		case "push":
+			// Pushing requires the source to connect to the destination
+			// on its own, which needs server side support.
+			if !source.HasExtension("container_push_target") {
+				return fmt.Errorf(i18n.G("The source LXD doesn't support push mode, use --mode=relay instead"))
+			}
+
+			if !dest.HasExtension("container_push") {
+				return fmt.Errorf(i18n.G("The destination LXD doesn't support push mode"))
+			}
+
+			if shared.IsSnapshot(sourceName) {
+				return fmt.Errorf(i18n.G("Snapshots can't be copied in push mode"))
+			}
+		case "relay":
+			if !dest.HasExtension("container_push") {
+				return fmt.Errorf(i18n.G("The destination LXD doesn't support relayed transfers"))
+			}
+		}
+
+		if c.bwlimit != "" && !source.HasExtension("container_migration_bwlimit") {
+			return fmt.Errorf(i18n.G("The source LXD doesn't support limiting the transfer rate"))
+		}
+
+		if c.allowInconsistent && !source.HasExtension("container_copy_allow_inconsistent") {
+			return fmt.Errorf(i18n.G("The source LXD doesn't support inconsistent copies"))
+		}
+
+		if c.compression != "" {
+			if !source.HasExtension("container_migration_compression") {
+				return fmt.Errorf(i18n.G("The source LXD doesn't support compressed transfers"))
+			}
+
+			if !dest.HasExtension("container_migration_compression") {
+				return fmt.Errorf(i18n.G("The destination LXD doesn't support compressed transfers"))
+			}
+		}
+
+		// The destination reports how much it received while transferring
+		if c.timeoutIdle > 0 && !dest.HasExtension("operation_fs_progress_bytes") {
+			return fmt.Errorf(i18n.G("The destination LXD doesn't report the transfer progress needed by --timeout-idle"))
+		}
+
+		// Only the source needs to know, the destination follows it
+		if c.protocol != "" && !source.HasExtension("container_migration_protocol") {
+			return fmt.Errorf(i18n.G("The source LXD doesn't support forcing the transfer protocol"))
+		}
+
+		args.Bwlimit = c.bwlimit
+		args.AllowInconsistent = c.allowInconsistent
+		args.Compression = c.compression
+		args.Protocol = c.protocol
+		args.Relay = c.mode == "relay"
+		args.Push = c.mode == "push"
+		args.Retries = c.retries
+
+		// Remember whether the destination exists so that a container
+		// we didn't create never gets deleted.
+		if destName != "" {
+			_, err := dest.ContainerInfo(destName)
+			destExisted = err == nil
+		}
+
+		if len(c.excludes) > 0 {
+			if !source.HasExtension("container_migration_excludes") {
+				return fmt.Errorf(i18n.G("The source LXD doesn't support excluding paths"))
+			}
+
+			args.Excludes = c.excludes
+		}
+
+		if len(c.snapshots) > 0 && source.HasExtension("container_migration_snapshot_list") {
+			args.Snapshots = c.snapshots
+			pruneSnapshots = false
+		} else if pruneSnapshots && args.Refresh {
+			return fmt.Errorf(i18n.G("The source LXD can't refresh a subset of the snapshots"))
+		}
+
+		// The destination only keeps a failed transfer around when
+		// it may be resumed.
+		if c.keepOnFail && !args.Refresh {
+			// Resuming would sync over a container we didn't create
+			if destExisted {
+				return fmt.Errorf(i18n.G("Container '%s' already exists, --keep-on-fail only applies to new containers"), destName)
+			}
+
+			if dest.HasExtension("container_migration_resume") {
+				args.Refresh = true
+			} else {
+				fmt.Fprintf(os.Stderr, i18n.G("The destination LXD always removes failed copies, --keep-on-fail has no effect")+"\n")
+			}
+		}
+
+		if c.dryRun {
+			err := c.checkProfiles(dest, plan.Profiles)
+			if err != nil {
+				return err
+			}
+
+			mode := c.mode
+			if mode == "" {
+				mode = "pull"
+			}
+
+			c.showPlan(sourceRemote, sourceName, destRemote, destName, fmt.Sprintf(i18n.G("migration (%s)"), mode), plan.Profiles, plan.Config)
+			return nil
+		}
+	}
+
+	if pruneSnapshots && !c.wait {
+		return fmt.Errorf(i18n.G("Copying a subset of the snapshots requires waiting for the copy with this LXD"))
+	}
+
+	if !c.expiryDate.IsZero() && !dest.HasExtension("container_expiry") {
+		return fmt.Errorf(i18n.G("The destination LXD doesn't support container expiry"))
+	}
+
+	if c.preHook != "" {
+		container := strings.SplitN(sourceName, shared.SnapshotDelimiter, 2)[0]
+		err := runHook(source, container, c.preHook)
+		if err != nil {
+			return exitError{fmt.Errorf(i18n.G("The pre-hook failed in '%s': %s"), container, err), copyExitHook}
+		}
+	}
+
+	// The devices of the container need the volumes to exist
+	copiedVolumes := []string{}
+	if len(copyVolumes) > 0 {
+		copiedVolumes, err = c.copyVolumes(source, dest, copyVolumes)
+		if err != nil {
+			_, ok := err.(lxd.MigrationError)
+			if ok {
+				return exitError{err, copyExitTransfer}
+			}
+
+			return err
+		}
+	}
+
+	// Move the existing destination out of the way, it's put back if the
+	// copy fails. Nothing else may fail between this and the copy.
+	var replaced *api.Container
+	backupName := ""
+	if c.replace && destName != "" {
+		backupName = replaceBackupName(destName, time.Now())
+		replaced, err = c.moveAside(dest, destName, backupName)
+		if err != nil {
+			return err
+		}
+
+		if replaced != nil {
+			destExisted = false
+		}
+	}
+
+	// Show what the servers are doing until the copy is over
+	eventsDone := make(chan bool)
+	if c.followEvents {
+		c.followCopyEvents(source, sourceRemote, strings.SplitN(sourceName, shared.SnapshotDelimiter, 2)[0], eventsDone)
+		if !local {
+			c.followCopyEvents(dest, destRemote, destName, eventsDone)
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.runCopy(source, sourceName, dest, args)
+
+	// The name may have been taken since it was picked
+	for retry := 0; err != nil && c.autoName && destName != "" && nameCollision(err) && retry < copyAutoNameRetries; retry++ {
+		previous := destName
+		destName, autoNameIndex, err = nextFreeName(dest, baseName, autoNameIndex+1)
+		if err != nil {
+			close(eventsDone)
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, i18n.G("Container '%s' already exists, copying to '%s' instead")+"\n", previous, destName)
+		args.Name = destName
+		resp, err = c.runCopy(source, sourceName, dest, args)
+	}
+
+	close(eventsDone)
+
+	if err != nil {
+		// A refresh keeps what was transferred so it can be resumed, and
+		// a container of the same name is never ours to delete
+		if !local && !destExisted && destName != "" && !c.keepOnFail && !c.refresh && !nameCollision(err) {
+			c.deleteFailedCopy(dest, destName)
+		}
+
+		if replaced != nil {
+			c.restoreReplaced(dest, replaced, backupName, destName)
+		}
+
+		if !c.keepOnFail {
+			c.deleteVolumes(dest, copiedVolumes)
+		}
+
+		switch err.(type) {
+		case exitError:
+			return err
+		case lxd.MissingProfilesError:
+			return exitError{err, copyExitProfiles}
+		case lxd.MigrationError:
+			return exitError{err, copyExitTransfer}
+		}
+
+		// Not reaching the local daemon is reported as such by main
+		if lxd.GetLocalLXDErr(err) != nil {
+			return err
+		}
+
+		return exitError{err, copyExitServer}
+	}
+
+	if !c.wait {
+		return c.copyStarted(sourceRemote, sourceName, resp, !local)
+	}
+
+	if replaced != nil {
+		if c.backup {
+			fmt.Fprintf(os.Stderr, i18n.G("The previous container was kept as '%s'")+"\n", backupName)
+		} else {
+			c.deleteReplaced(dest, backupName)
+		}
+	}
+
+	stats := copyStats{duration: time.Since(start), stateful: c.statefulTransfer}
+	if !local {
+		stats.bytes = transferredBytes(dest, resp)
+	}
+
+	// The source falls back to its disk when the container stopped since
+	if c.stateful && !stats.stateful {
+		fmt.Fprintf(os.Stderr, i18n.G("The container wasn't running anymore, only its disk was copied")+"\n")
+	}
+
+	if c.toImage {
+		fingerprint, err := c.publishCopy(dest, destName, resp)
+		if err != nil {
+			return err
+		}
+
+		return c.imageDone(sourceRemote, sourceName, fingerprint, !local, stats)
+	}
+
+	if c.verify {
+		err = c.verifyCopy(source, sourceName, dest, destName, resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pruneSnapshots {
+		err = c.pruneSnapshots(dest, destName, resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.renameSnapshots(dest, destName, resp, snapshotRenames)
+	if err != nil {
+		return err
+	}
+
+	err = c.setDescription(dest, destName, resp)
+	if err != nil {
+		return err
+	}
+
+	// The copy stands even when it can't be started
+	if c.start {
+		err = c.startCopy(dest, destName, resp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, i18n.G("The new container couldn't be started: %s")+"\n", err)
+		} else {
+			stats.started = true
+		}
+	}
+
+	if c.postHook != "" {
+		name := destName
+		if name == "" {
+			name, err = copiedName(resp)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !stats.started {
+			return exitError{fmt.Errorf(i18n.G("The post-hook can't run in '%s', it isn't running"), name), copyExitHook}
+		}
+
+		err = runHook(dest, name, c.postHook)
+		if err != nil {
+			return exitError{fmt.Errorf(i18n.G("The post-hook failed in '%s': %s"), name, err), copyExitHook}
+		}
+	}
+
+	if c.manifest != "" {
+		name := destName
+		if name == "" {
+			name, err = copiedName(resp)
+			if err != nil {
+				return err
+			}
+		}
+
+		set, removed := configOverrides(src.Config, plan.Config)
+		manifest := copyManifest{
+			Source:          fmt.Sprintf("%s:%s", sourceRemote, sourceName),
+			Destination:     fmt.Sprintf("%s:%s", destRemote, name),
+			Migrated:        !local,
+			Profiles:        plan.Profiles,
+			Config:          set,
+			ConfigRemoved:   removed,
+			BaseImage:       src.Config["volatile.base_image"],
+			Bytes:           stats.bytes,
+			StartedAt:       start.UTC(),
+			CompletedAt:     time.Now().UTC(),
+			SourceOperation: c.sourceOperation,
+			Operation:       resp.Operation,
+		}
+
+		err = writeManifest(c.manifest, manifest)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to write the manifest '%s': %s"), c.manifest, err)
+		}
+	}
+
+	return c.copyDone(sourceRemote, sourceName, destName, resp, !local, stats)
+}
+
+// configOverrides returns the keys the copy set to another value than the
+// source had and those it removed, leaving out the volatile keys which are
+// dropped along the way anyway
+func configOverrides(source map[string]string, result map[string]string) (map[string]string, []string) {
+	set := map[string]string{}
+	for key, value := range result {
+		old, ok := source[key]
+		if !ok || old != value {
+			set[key] = value
+		}
+	}
+
+	removed := []string{}
+	for key := range source {
+		if strings.HasPrefix(key, "volatile") {
+			continue
+		}
+
+		_, ok := result[key]
+		if !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(removed)
+
+	return set, removed
+}
+
+// writeManifest writes the manifest to the file, replacing it
+func writeManifest(file string, manifest copyManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// runCopy copies the container through the client library, showing the
+// transfer progress and cancelling copies between remotes after --timeout.
+func (c *copyCmd) runCopy(source *lxd.Client, sourceName string, dest *lxd.Client, args lxd.ContainerCopyArgs) (*api.Response, error) {
+	var lock sync.Mutex
+	var progress *ProgressRenderer
+	var progressDone chan bool
+	var idleDone chan bool
+	finished := false
+	stalled := false
+
+	// The deadline covers all the attempts
+	ctx := context.Background()
+	if c.timeout > 0 && source.Name != dest.Name {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args.NoWait = !c.wait
+	args.OnStateful = func(stateful bool) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		c.statefulTransfer = stateful
+	}
+
+	args.OnProfilesSlow = func() {
+		fmt.Fprintf(os.Stderr, i18n.G("Checking destination profiles...")+"\n")
+	}
+
+	args.OnMigrationAddressFailed = func(address string, err error) {
+		fmt.Fprintf(os.Stderr, i18n.G("The migration address %s of the source remote can't be used, trying its other addresses: %s")+"\n", address, err)
+	}
+
+	args.OnTransfer = func(sourceOp string, destOp string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		c.sourceOperation = sourceOp
+		if !c.wait {
+			return
+		}
+
+		// Give up on transfers which stopped making progress
+		if c.timeoutIdle > 0 && !finished {
+			if idleDone != nil {
+				close(idleDone)
+			}
+
+			idleDone = make(chan bool)
+			go c.watchIdle(dest, destOp, func() {
+				lock.Lock()
+				stalled = true
+				lock.Unlock()
+
+				cancel()
+			}, idleDone)
+		}
+
+		// Show the transfer progress when attached to a terminal
+		if finished || !termios.IsTerminal(int(syscall.Stdout)) || c.format == listFormatJSON || c.quiet || c.parallel > 1 {
+			return
+		}
+
+		if progressDone != nil {
+			close(progressDone)
+		} else {
+			progress = &ProgressRenderer{Format: i18n.G("Transferring container: %s")}
+		}
+
+		progressDone = make(chan bool)
+		c.migrationProgressTracker(dest, progress, destOp, progressDone)
+	}
+
+	var resp *api.Response
+	copyDone := make(chan error, 1)
+	go func() {
+		var err error
+		resp, err = source.CopyContainer(ctx, sourceName, dest, args)
+		copyDone <- err
+	}()
+
+	var err error
+	select {
+	case err = <-copyDone:
+	case <-ctx.Done():
+		// Give the operations a chance to get cancelled, a relayed
+		// transfer only stops once we exit.
+		select {
+		case <-copyDone:
+		case <-time.After(5 * time.Second):
+		}
+
+		err = ctx.Err()
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	finished = true
+	if progressDone != nil {
+		close(progressDone)
+		progress.Done("")
+	}
+
+	if idleDone != nil {
+		close(idleDone)
+	}
+
+	if stalled {
+		return nil, exitError{fmt.Errorf(i18n.G("The transfer made no progress for %s"), c.timeoutIdle), copyExitTransfer}
+	}
+
+	if err == context.DeadlineExceeded {
+		return nil, exitError{fmt.Errorf(i18n.G("The copy didn't complete within %s"), c.timeout), copyExitTransfer}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// copySource is what the copy starts from, as found on the source remote
+type copySource struct {
+	Remote       string
+	Snapshot     bool
+	Architecture string
+	Devices      map[string]map[string]string
+	Expanded     map[string]map[string]string
+	Config       map[string]string
+	Profiles     []string
+	CreatedAt    time.Time
+	LastUsedAt   time.Time
+	Running      bool
+	Ephemeral    bool
+
+	// Profiles of the --profile-from container
+	ProfilesFrom []string
+}
+
+// copyDestination is what the copy needs to know about the destination
+// remote before connecting to it
+type copyDestination struct {
+	Remote   string
+	Profiles []string
+}
+
+// copyPlan is the new container as resolved from the source and the options,
+// along with whether it's done as a local copy
+type copyPlan struct {
+	Local         bool
+	Architecture  string
+	Config        map[string]string
+	Devices       map[string]map[string]string
+	Profiles      []string
+	Ephemeral     bool
+	ContainerOnly bool
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+
+	// Volatile keys the new container keeps, the others are dropped
+	Volatile []string
+
+	// Warnings to show before copying
+	Warnings []string
+}
+
+// computeCopyPlan works out the new container from the source and the
+// options without talking to any remote. Different remotes which turn out to
+// be the same server are left to the caller.
+func (c *copyCmd) computeCopyPlan(source copySource, dest copyDestination, ephemeral *bool, stateful bool, containerOnly bool, keepVolatile bool) (copyPlan, error) {
+	plan := copyPlan{
+		Local:        source.Remote == dest.Remote,
+		Architecture: source.Architecture,
+		Config:       copyConfigMap(source.Config),
+		Devices:      copyDevicesMap(source.Devices),
+		Profiles:     append([]string{}, source.Profiles...),
+		CreatedAt:    source.CreatedAt,
+		LastUsedAt:   source.LastUsedAt,
+	}
+
+	// Local copies and migrations follow the same rule
+	plan.Ephemeral = copyEphemeral(ephemeral, source.Ephemeral)
+
+	if c.rootfsOnly {
+		plan.Config = rootfsOnlyConfig(plan.Config)
+		plan.Devices = map[string]map[string]string{}
+	}
+
+	// Copying a snapshot creates a standalone container, there are no
+	// snapshots to bring along.
+	plan.ContainerOnly = containerOnly || source.Snapshot
+
+	if c.stateful {
+		if plan.Local {
+			return copyPlan{}, fmt.Errorf(i18n.G("Stateful copies are only supported between different remotes"))
+		}
+
+		if !source.Running {
+			return copyPlan{}, fmt.Errorf(i18n.G("Stateful copies require the source container to be running"))
+		}
+	}
+
+	if c.allowInconsistent && (stateful || source.Snapshot) {
+		return copyPlan{}, fmt.Errorf(i18n.G("--allow-inconsistent can only be used for stateless copies of containers"))
+	}
+
+	if c.verify {
+		if source.Snapshot {
+			return copyPlan{}, fmt.Errorf(i18n.G("Verifying copies of snapshots isn't supported"))
+		}
+
+		if source.Running || c.stateful {
+			return copyPlan{}, fmt.Errorf(i18n.G("Verifying copies requires the source container to be stopped"))
+		}
+	}
+
+	// The spec is merged over the source, devices are replaced as a whole
+	if c.spec != nil {
+		if c.spec.Architecture != "" {
+			plan.Architecture = c.spec.Architecture
+		}
+
+		for key, value := range c.spec.Config {
+			plan.Config[key] = value
+		}
+
+		for name, dev := range c.spec.Devices {
+			plan.Devices[name] = copyConfigMap(dev)
+		}
+
+		if c.spec.Profiles != nil {
+			plan.Profiles = append([]string{}, c.spec.Profiles...)
+		}
+	}
+
+	if c.profileFrom != "" {
+		plan.Profiles = append([]string{}, source.ProfilesFrom...)
+	}
+
+	if c.noProfiles {
+		plan.Profiles = []string{}
+	} else {
+		for _, profile := range dest.Profiles {
+			if !shared.StringInSlice(profile, plan.Profiles) {
+				plan.Profiles = append(plan.Profiles, profile)
+			}
+		}
+	}
+
+	if c.profArgs != nil {
+		plan.Profiles = append(plan.Profiles, c.profArgs...)
+	}
+
+	if c.profPrepend != nil {
+		plan.Profiles = prependProfiles(plan.Profiles, c.profPrepend)
+	}
+
+	for key, value := range c.fileConfig {
+		plan.Config[key] = value
+	}
+
+	for key, value := range c.instanceConfig {
+		plan.Config[key] = value
+	}
+
+	for _, entry := range c.confArgs {
+		items := strings.SplitN(entry, "=", 2)
+
+		_, ok := c.instanceConfig[items[0]]
+		if ok {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf(i18n.G("Using %s from --config instead of the one from --instance-type"), items[0]))
+		}
+
+		plan.Config[items[0]] = items[1]
+	}
+
+	for _, entry := range c.deviceArgs {
+		name, values, _ := parseDeviceOverride(entry)
+
+		// Overriding a device of the profiles makes a local copy of it
+		_, ok := plan.Devices[name]
+		if !ok {
+			plan.Devices[name] = copyConfigMap(source.Expanded[name])
+		}
+
+		for key, value := range values {
+			plan.Devices[name][key] = value
+		}
+	}
+
+	// Point the root disk at the requested storage pool, adding a local
+	// root disk device if it currently comes from a profile.
+	if c.storagePool != "" {
+		rootDev := ""
+		for name, dev := range plan.Devices {
+			if dev["type"] == "disk" && dev["path"] == "/" && dev["source"] == "" {
+				rootDev = name
+				break
+			}
+		}
+
+		if rootDev == "" {
+			rootDev = "root"
+			plan.Devices[rootDev] = map[string]string{
+				"type": "disk",
+				"path": "/",
+			}
+		}
+
+		plan.Devices[rootDev]["pool"] = c.storagePool
+	}
+
+	if c.network != "" {
+		repointNICs(plan.Devices, source.Expanded, c.network)
+	}
+
+	// Only send the timestamps along when asked to keep them
+	if !c.preserveTimestamps {
+		plan.CreatedAt = time.Time{}
+		plan.LastUsedAt = time.Time{}
+	}
+
+	for _, key := range c.unsetKeys {
+		if !strings.HasSuffix(key, "*") {
+			delete(plan.Config, key)
+			continue
+		}
+
+		for k := range plan.Config {
+			if strings.HasPrefix(k, strings.TrimSuffix(key, "*")) {
+				delete(plan.Config, k)
+			}
+		}
+	}
+
+	// Have the destination shift the files to the requested map
+	if len(c.mapUIDs) > 0 || len(c.mapGIDs) > 0 {
+		if shared.IsTrue(plan.Config["security.privileged"]) {
+			return copyPlan{}, fmt.Errorf(i18n.G("--map-uid and --map-gid can't be used with a privileged container"))
+		}
+
+		lines := []string{}
+		if plan.Config["raw.idmap"] != "" {
+			lines = append(lines, plan.Config["raw.idmap"])
+		}
+
+		for _, entry := range c.mapUIDs {
+			lines = append(lines, "uid "+entry)
+		}
+
+		for _, entry := range c.mapGIDs {
+			lines = append(lines, "gid "+entry)
+		}
+
+		plan.Config["raw.idmap"] = strings.Join(lines, "\n")
+	}
+
+	// Have the destination delete the copy once it expired, the copy
+	// doesn't inherit the expiry of the source
+	if !c.expiryDate.IsZero() {
+		plan.Config["expiry"] = c.expiryDate.UTC().Format(time.RFC3339)
+	} else {
+		delete(plan.Config, "expiry")
+	}
+
+	// The keys themselves are dropped by the client, which still needs
+	// the base image of the source.
+	for key := range plan.Config {
+		if !strings.HasPrefix(key, "volatile") {
+			continue
+		}
+
+		kept := keepVolatile
+		for _, prefix := range c.configPreserve {
+			if strings.HasPrefix(key, prefix) {
+				kept = true
+			}
+		}
+
+		if kept {
+			plan.Volatile = append(plan.Volatile, key)
+		}
+	}
+
+	sort.Strings(plan.Volatile)
+
+	return plan, nil
+}
+
+// parseDeviceOverride parses a --device value of the form
+// <name>,<key>=<value>[,<key>=<value>...]
+func parseDeviceOverride(value string) (string, map[string]string, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) < 2 || fields[0] == "" {
+		return "", nil, fmt.Errorf(i18n.G("Invalid device '%s', must be of the form <name>,<key>=<value>"), value)
+	}
+
+	values := map[string]string{}
+	for _, field := range fields[1:] {
+		items := strings.SplitN(field, "=", 2)
+		if len(items) != 2 || items[0] == "" {
+			return "", nil, fmt.Errorf(i18n.G("Invalid device '%s', must be of the form <name>,<key>=<value>"), value)
+		}
+
+		values[items[0]] = items[1]
+	}
+
+	return fields[0], values, nil
+}
+
+// copyConfigMap returns a copy of the config which can be modified without
+// affecting the original
+func copyConfigMap(config map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range config {
+		result[key] = value
+	}
+
+	return result
+}
+
+// copyDevicesMap returns a copy of the devices which can be modified without
+// affecting the original
+func copyDevicesMap(devices map[string]map[string]string) map[string]map[string]string {
+	result := map[string]map[string]string{}
+	for name, dev := range devices {
+		result[name] = copyConfigMap(dev)
+	}
+
+	return result
+}
+
+// newClient connects to a remote, with the certificate given by --cert and
+// --key if any
+func (c *copyCmd) newClient(config *lxd.Config, remote string) (*lxd.Client, error) {
+	return lxd.NewClientWithCert(config, remote, c.clientCert, c.clientKey)
+}
+
+// parseCopyBatch parses the entries of a --batch file
+func parseCopyBatch(content []byte) ([]copyBatchEntry, error) {
+	entries := []copyBatchEntry{}
+	err := yaml.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range entries {
+		if entry.Source == "" {
+			return nil, fmt.Errorf(i18n.G("entry %d has no source"), i+1)
+		}
+
+		for key := range entry.Config {
+			if key == "" {
+				return nil, fmt.Errorf(i18n.G("entry %d has an empty config key"), i+1)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// batchCopy returns the command doing a copy of a --batch file, with the
+// profiles and config of the entry added to the ones of c
+func (c *copyCmd) batchCopy(entry copyBatchEntry) *copyCmd {
+	cpy := *c
+
+	cpy.profArgs = append(profileList{}, c.profArgs...)
+	cpy.profArgs = append(cpy.profArgs, entry.Profiles...)
+
+	keys := []string{}
+	for key := range entry.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cpy.confArgs = append(configList{}, c.confArgs...)
+	for _, key := range keys {
+		cpy.confArgs = append(cpy.confArgs, fmt.Sprintf("%s=%s", key, entry.Config[key]))
+	}
+
+	return &cpy
+}
+
+// runBatch does the copies of a --batch file and prints a table with the
+// status of each of them
+func (c *copyCmd) runBatch(config *lxd.Config, entries []copyBatchEntry, ephemeral *bool) error {
+	errs := runCopyJobs(c.parallel, len(entries), func(i int) error {
+		entry := entries[i]
+		return c.batchCopy(entry).copyContainer(config, entry.Source, entry.Dest, c.keepVolatile, ephemeral, c.stateful, c.containerOnly)
+	})
+
+	data := [][]string{}
+	success := true
+	for i, entry := range entries {
+		status := i18n.G("OK")
+		if errs[i] != nil {
+			success = false
+			status = fmt.Sprintf(i18n.G("error: %v"), errs[i])
+		}
+
+		data = append(data, []string{entry.Source, entry.Dest, status})
+	}
+
+	// The table would get in the way of the JSON output of each copy
+	if c.format != listFormatJSON && !c.quiet {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoWrapText(false)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetRowLine(true)
+		table.SetHeader([]string{
+			i18n.G("SOURCE"),
+			i18n.G("DESTINATION"),
+			i18n.G("STATUS")})
+		table.AppendBulk(data)
+		table.Render()
+	}
+
+	if !success {
+		return fmt.Errorf(i18n.G("Some containers failed to copy"))
+	}
+
+	return nil
+}
+
+// isSourceGlob returns whether a copy source is a glob pattern
+func isSourceGlob(source string) bool {
+	return strings.ContainsAny(source, "*?[")
+}
+
+// expandSourceGlobs turns the sources into batch entries copying to the
+// destination remote, the glob patterns among them being replaced by the
+// matching containers of their remote
+func (c *copyCmd) expandSourceGlobs(config *lxd.Config, sources []string, destResource string) ([]copyBatchEntry, error) {
+	entries := []copyBatchEntry{}
+	seen := map[string]bool{}
+	add := func(source string) {
+		if !seen[source] {
+			seen[source] = true
+			entries = append(entries, copyBatchEntry{Source: source, Dest: destResource})
+		}
+	}
+
+	for _, source := range sources {
+		if !isSourceGlob(source) {
+			add(source)
+			continue
+		}
+
+		remote, pattern := config.ParseRemoteAndContainer(source)
+		if shared.IsSnapshot(pattern) {
+			return nil, fmt.Errorf(i18n.G("Glob patterns can only match containers, not snapshots: %s"), source)
+		}
+
+		d, err := c.newClient(config, remote)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.project != "" {
+			d = d.UseProject(c.project)
+		}
+
+		containers, err := d.ListContainers()
+		if err != nil {
+			return nil, err
+		}
+
+		names, err := matchContainerNames(containers, pattern)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("Invalid glob pattern '%s': %s"), source, err)
+		}
+
+		if len(names) == 0 {
+			return nil, fmt.Errorf(i18n.G("No container matches '%s'"), source)
+		}
+
+		fmt.Fprintf(os.Stderr, i18n.G("%d containers match '%s'")+"\n", len(names), source)
+		for _, name := range names {
+			add(fmt.Sprintf("%s:%s", remote, name))
+		}
+	}
+
+	return entries, nil
+}
+
+// matchContainerNames returns the sorted names of the containers matching a
+// glob pattern
+func matchContainerNames(containers []api.Container, pattern string) ([]string, error) {
+	names := []string{}
+	for _, ct := range containers {
+		ok, err := path.Match(pattern, ct.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			names = append(names, ct.Name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// runCopyJobs runs count jobs with at most workers of them at the same time
+// and returns the error of each of them, a failed job doesn't stop the others
+func runCopyJobs(workers int, count int, job func(i int) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	errs := make([]error, count)
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = job(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+	return errs
+}
+
+// parseCopyDestination returns the remote and name of the new container. A
+// destination of "<remote>:" keeps the name of the source container while an
+// empty one lets the server pick a name.
+func parseCopyDestination(config *lxd.Config, destResource string, sourceName string) (string, string) {
+	destRemote, destName := config.ParseRemoteAndContainer(destResource)
+	if destName == "" && destResource != "" {
+		destName = strings.SplitN(sourceName, shared.SnapshotDelimiter, 2)[0]
+	}
+
+	return destRemote, destName
+}
+
+// rootfsOnlyConfig returns the config keys kept by --rootfs-only, which
+// describe the filesystem rather than how the container runs
+func rootfsOnlyConfig(config map[string]string) map[string]string {
+	kept := map[string]string{}
+	for k, v := range config {
+		if strings.HasPrefix(k, "image.") || strings.HasPrefix(k, "volatile.") {
+			kept[k] = v
+		}
+	}
+
+	return kept
+}
+
+// copyEphemeral returns whether the new container is ephemeral, as requested
+// or otherwise like its source
+func copyEphemeral(requested *bool, source bool) bool {
+	if requested == nil {
+		return source
+	}
+
+	return *requested
+}
+
+// repointNICs attaches the network interfaces to the network, overriding
+// those which come from a profile with a device of the container.
+func repointNICs(devices map[string]map[string]string, expanded map[string]map[string]string, network string) {
+	for name, dev := range expanded {
+		if dev["type"] != "nic" {
+			continue
+		}
+
+		_, ok := devices[name]
+		if ok {
+			continue
+		}
+
+		_, ok = dev["network"]
+		if ok || dev["parent"] != "" {
+			devices[name] = copyConfigMap(dev)
+		}
+	}
+
+	for _, dev := range devices {
+		if dev["type"] != "nic" {
+			continue
+		}
+
+		_, ok := dev["network"]
+		if ok {
+			dev["network"] = network
+		} else if dev["parent"] != "" {
+			dev["parent"] = network
+		}
+	}
+}
+
+// customVolumes returns the custom storage volumes used by the devices
+func customVolumes(devices map[string]map[string]string) []string {
+	volumes := []string{}
+	for _, dev := range devices {
+		if dev["type"] != "disk" || dev["pool"] == "" || dev["source"] == "" {
+			continue
+		}
+
+		volumes = append(volumes, fmt.Sprintf("%s/%s", dev["pool"], dev["source"]))
+	}
+
+	sort.Strings(volumes)
+
+	return volumes
+}
+
+// parseTargetSpec parses a --target-spec, telling which field is invalid if
+// any
+func parseTargetSpec(content string) (*copyTargetSpec, error) {
+	raw := map[string]interface{}{}
+	err := json.Unmarshal([]byte(content), &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range raw {
+		if !shared.StringInSlice(key, []string{"project", "pool", "member", "instance_type"}) {
+			return nil, fmt.Errorf(i18n.G("unknown field '%s'"), key)
+		}
+
+		str, ok := value.(string)
+		if !ok || str == "" {
+			return nil, fmt.Errorf(i18n.G("field '%s' must be a non-empty string"), key)
+		}
+	}
+
+	spec := copyTargetSpec{}
+	err = json.Unmarshal([]byte(content), &spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.InstanceType != "" {
+		_, err := instanceTypeConfig(spec.InstanceType)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("field '%s': %s"), "instance_type", err)
+		}
+	}
+
+	return &spec, nil
+}
+
+// applyTargetSpec sets the options of the --target-spec fields whose flag
+// wasn't given
+func (c *copyCmd) applyTargetSpec(spec *copyTargetSpec, set map[string]bool) {
+	if spec.Project != "" && !set["target-project"] {
+		c.targetProject = spec.Project
+	}
+
+	if spec.Pool != "" && !set["storage"] && !set["s"] {
+		c.storagePool = spec.Pool
+	}
+
+	if spec.Member != "" && !set["target"] {
+		c.target = spec.Member
+	}
+
+	if spec.InstanceType != "" && !set["instance-type"] {
+		c.instanceType = spec.InstanceType
+	}
+}
+
+// instanceTypeConfig returns the limits matching an instance type of the
+// form c<CPU>-m<RAM in GB>
+func instanceTypeConfig(instanceType string) (map[string]string, error) {
+	fields := strings.Split(instanceType, "-")
+	if len(fields) != 2 || !strings.HasPrefix(fields[0], "c") || !strings.HasPrefix(fields[1], "m") {
+		return nil, fmt.Errorf(i18n.G("Invalid instance type '%s', must be of the form c<CPU>-m<RAM in GB>"), instanceType)
+	}
+
+	cpu, err := strconv.Atoi(fields[0][1:])
+	if err != nil || cpu < 1 {
+		return nil, fmt.Errorf(i18n.G("Invalid CPU count in instance type '%s'"), instanceType)
+	}
+
+	memory, err := strconv.ParseFloat(fields[1][1:], 64)
+	if err != nil || memory <= 0 {
+		return nil, fmt.Errorf(i18n.G("Invalid memory size in instance type '%s'"), instanceType)
+	}
+
+	return map[string]string{
+		"limits.cpu":    fmt.Sprintf("%d", cpu),
+		"limits.memory": fmt.Sprintf("%dMB", int64(memory*1024)),
+	}, nil
+}
+
+// showPlan prints what a copy would do along with the config keys it
+// overrides
+func (c *copyCmd) showPlan(sourceRemote string, sourceName string, destRemote string, destName string, method string, profiles []string, config map[string]string) {
+	if destName == "" {
+		destName = i18n.G("(picked by the server)")
+	}
+
+	overrides := []string{}
+	if c.spec != nil {
+		for key := range c.spec.Config {
+			overrides = append(overrides, key)
+		}
+	}
+
+	for key := range c.fileConfig {
+		overrides = append(overrides, key)
+	}
+
+	for key := range c.instanceConfig {
+		overrides = append(overrides, key)
+	}
+
+	for _, entry := range c.confArgs {
+		overrides = append(overrides, strings.SplitN(entry, "=", 2)[0])
+	}
+
+	sort.Strings(overrides)
+
+	fmt.Printf(i18n.G("Source: %s:%s")+"\n", sourceRemote, sourceName)
+	fmt.Printf(i18n.G("Destination: %s:%s")+"\n", destRemote, destName)
+	fmt.Printf(i18n.G("Method: %s")+"\n", method)
+	fmt.Printf(i18n.G("Profiles: %s")+"\n", strings.Join(profiles, ", "))
+	if c.storagePool != "" {
+		fmt.Printf(i18n.G("Storage pool: %s")+"\n", c.storagePool)
+	}
+
+	if len(overrides) > 0 {
+		fmt.Printf(i18n.G("Config:") + "\n")
+		for i, key := range overrides {
+			if i > 0 && overrides[i-1] == key {
+				continue
+			}
+
+			fmt.Printf("  %s=%s\n", key, config[key])
+		}
+	}
+}
+
+// profilesFrom returns the profiles of the --profile-from container, a
+// container without a remote is looked up on the source remote
+func (c *copyCmd) profilesFrom(config *lxd.Config, source *lxd.Client, sourceRemote string) ([]string, error) {
+	remote, name := config.ParseRemoteAndContainer(c.profileFrom)
+	if !strings.Contains(c.profileFrom, ":") {
+		remote = sourceRemote
+	}
+
+	d := source
+	if remote != sourceRemote {
+		var err error
+		d, err = c.newClient(config, remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ct, err := d.ContainerInfo(name)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("Unable to get the profiles of '%s': %s"), c.profileFrom, err)
+	}
+
+	return append([]string{}, ct.Profiles...), nil
+}
+
+// prependProfiles puts profiles in front of the others so that the later
+// ones take precedence over them, dropping their other occurrences
+func prependProfiles(profiles []string, prepend []string) []string {
+	result := []string{}
+	for _, profile := range prepend {
+		if !shared.StringInSlice(profile, result) {
+			result = append(result, profile)
+		}
+	}
+
+	for _, profile := range profiles {
+		if !shared.StringInSlice(profile, result) {
+			result = append(result, profile)
+		}
+	}
+
+	return result
+}
+
+// parseExpiry returns the date of an --expiry, either a duration from now
+// (e.g. 12h or 7d) or a date (YYYY-MM-DD or RFC3339) which must be in the
+// future
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	var expiry time.Time
+
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf(i18n.G("Invalid expiry '%s', must be a duration or a date"), value)
+		}
+
+		expiry = now.Add(time.Duration(days) * 24 * time.Hour)
+	} else if duration, err := time.ParseDuration(value); err == nil {
+		expiry = now.Add(duration)
+	} else if date, err := time.Parse(time.RFC3339, value); err == nil {
+		expiry = date
+	} else if date, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		expiry = date
+	} else {
+		return time.Time{}, fmt.Errorf(i18n.G("Invalid expiry '%s', must be a duration or a date"), value)
+	}
+
+	if !expiry.After(now) {
+		return time.Time{}, fmt.Errorf(i18n.G("The expiry '%s' isn't in the future"), value)
+	}
+
+	return expiry, nil
+}
+
+// checkVolumes checks that the custom volumes can be copied to the pools of
+// the same name on the destination without overwriting anything
+func (c *copyCmd) checkVolumes(source *lxd.Client, dest *lxd.Client, volumes []string) error {
+	if !source.HasExtension("storage_api_volume_rsync") {
+		return fmt.Errorf(i18n.G("The source LXD doesn't support copying custom storage volumes"))
+	}
+
+	if !dest.HasExtension("storage_api_volume_rsync") {
+		return fmt.Errorf(i18n.G("The destination LXD doesn't support copying custom storage volumes"))
+	}
+
+	for _, volume := range volumes {
+		fields := strings.SplitN(volume, "/", 2)
+
+		_, err := dest.StoragePoolGet(fields[0])
+		if err != nil {
+			return fmt.Errorf(i18n.G("Storage pool '%s' isn't available on the destination: %s"), fields[0], err)
+		}
+
+		_, err = dest.StoragePoolVolumeTypeGet(fields[0], fields[1], "custom")
+		if err == nil {
+			return fmt.Errorf(i18n.G("Storage volume '%s' already exists on the destination"), volume)
+		}
+
+		if err != lxd.LXDErrors[http.StatusNotFound] {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyVolumes copies the custom volumes to the destination, returning the
+// ones it copied. A failed copy removes them all again.
+func (c *copyCmd) copyVolumes(source *lxd.Client, dest *lxd.Client, volumes []string) ([]string, error) {
+	copied := []string{}
+	for _, volume := range volumes {
+		fields := strings.SplitN(volume, "/", 2)
+
+		if !c.quiet {
+			fmt.Fprintf(os.Stderr, i18n.G("Copying the storage volume %s")+"\n", volume)
+		}
+
+		err := source.StoragePoolVolumeCopy(context.Background(), fields[0], fields[1], dest, fields[0])
+		if err != nil {
+			c.deleteVolumes(dest, copied)
+			return nil, err
+		}
+
+		copied = append(copied, volume)
+	}
+
+	return copied, nil
+}
+
+// deleteVolumes removes the custom volumes copied for a failed copy
+func (c *copyCmd) deleteVolumes(d *lxd.Client, volumes []string) {
+	for _, volume := range volumes {
+		fields := strings.SplitN(volume, "/", 2)
+
+		err := d.StoragePoolVolumeTypeDelete(fields[0], fields[1], "custom")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the copied storage volume '%s': %s")+"\n", volume, err)
+		}
+	}
+}
+
+// deleteFailedCopy removes what's left of a failed copy, if anything
+func (c *copyCmd) deleteFailedCopy(d *lxd.Client, name string) {
+	_, err := d.ContainerInfo(name)
+	if err != nil {
+		return
+	}
+
+	resp, err := d.Delete(name)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the partially copied container '%s': %s")+"\n", name, err)
+	}
+}
+
+// replaceBackupName returns the name the destination container is kept under
+// while --replace copies over it
+func replaceBackupName(name string, now time.Time) string {
+	return fmt.Sprintf("%s-backup-%s", name, now.UTC().Format("20060102150405"))
+}
+
+// copyPromptLock keeps the confirmations of parallel copies from mixing
+var copyPromptLock sync.Mutex
+
+// confirmReplace asks whether the existing container may be replaced
+func confirmReplace(in io.Reader, out io.Writer, name string) error {
+	fmt.Fprintf(out, i18n.G("Replace the existing container '%s', deleting it (yes/no): "), name)
+
+	input, _ := bufio.NewReader(in).ReadString('\n')
+	input = strings.TrimSpace(input)
+	if !shared.StringInSlice(strings.ToLower(input), []string{i18n.G("yes")}) {
+		return fmt.Errorf(i18n.G("User aborted the copy"))
+	}
+
+	return nil
+}
+
+// moveAside stops the existing destination container and renames it to
+// backupName so that the copy can take its name. It returns the container as
+// it was, or nil when there's nothing to replace.
+func (c *copyCmd) moveAside(d *lxd.Client, name string, backupName string) (*api.Container, error) {
+	ct, err := d.ContainerInfo(name)
+	if err == lxd.LXDErrors[http.StatusNotFound] {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The replaced container is only deleted without --backup
+	if !c.backup && !c.yes {
+		if !termios.IsTerminal(int(syscall.Stdin)) {
+			return nil, fmt.Errorf(i18n.G("Replacing '%s' deletes it, use --yes to confirm"), name)
+		}
+
+		copyPromptLock.Lock()
+		err := confirmReplace(os.Stdin, os.Stderr, name)
+		copyPromptLock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ct.IsActive() {
+		resp, err := d.Action(name, shared.Stop, -1, true, false)
+		if err == nil {
+			err = d.WaitForSuccess(resp.Operation)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("Unable to stop '%s' to replace it: %s"), name, err)
+		}
+	}
+
+	resp, err := d.Rename(name, backupName)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("Unable to move '%s' aside to replace it: %s"), name, err)
+	}
+
+	return ct, nil
+}
+
+// restoreReplaced puts back the container which a failed copy was to replace,
+// starting it again if it was running
+func (c *copyCmd) restoreReplaced(d *lxd.Client, ct *api.Container, backupName string, name string) {
+	resp, err := d.Rename(backupName, name)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.G("Failed to restore the previous container from '%s': %s")+"\n", backupName, err)
+		return
+	}
+
+	if !ct.IsActive() {
+		return
+	}
+
+	resp, err = d.Action(name, shared.Start, -1, false, false)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.G("Failed to start the previous container '%s' again: %s")+"\n", name, err)
+	}
+}
+
+// deleteReplaced removes the container which was replaced by the copy
+func (c *copyCmd) deleteReplaced(d *lxd.Client, backupName string) {
+	resp, err := d.Delete(backupName)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the replaced container, it's left as '%s': %s")+"\n", backupName, err)
+	}
+}
+
+// sameServer returns whether both clients talk to the same server, based on
+// the fingerprint of its certificate
+func sameServer(source *lxd.Client, dest *lxd.Client) (bool, error) {
+	sourceStatus, err := source.ServerStatus()
+	if err != nil {
+		return false, err
+	}
+
+	destStatus, err := dest.ServerStatus()
+	if err != nil {
+		return false, err
+	}
+
+	fingerprint := sourceStatus.Environment.CertificateFingerprint
+	return fingerprint != "" && fingerprint == destStatus.Environment.CertificateFingerprint, nil
+}
+
+// sameContainer returns whether the destination is the source container, or
+// the container of the source snapshot, provided both are on the same server
+func sameContainer(sourceName string, sourceProject string, destName string, destProject string) bool {
+	if destName == "" {
+		return false
+	}
+
+	if sourceProject == "" {
+		sourceProject = "default"
+	}
+
+	if destProject == "" {
+		destProject = "default"
+	}
+
+	container := strings.SplitN(sourceName, shared.SnapshotDelimiter, 2)[0]
+	return container == destName && sourceProject == destProject
+}
+
+// checkTargetProject makes sure the destination can take the container into
+// the --target-project project
+func (c *copyCmd) checkTargetProject(d *lxd.Client) error {
+	if c.targetProject == "" {
+		return nil
+	}
+
+	if !d.HasExtension("projects") {
+		return fmt.Errorf(i18n.G("--target-project can only be used with remotes supporting projects"))
+	}
+
+	return nil
+}
+
+// checkArchitecture warns about, or with --strict-arch refuses, copies to a
+// remote which doesn't support the architecture of the container
+func (c *copyCmd) checkArchitecture(d *lxd.Client, remote string, architecture string) error {
+	server, err := d.ServerStatus()
+	if err != nil {
+		return err
+	}
+
+	supported := server.Environment.Architectures
+	if len(supported) == 0 || shared.StringInSlice(architecture, supported) {
+		return nil
+	}
+
+	if c.strictArch {
+		err := fmt.Errorf(i18n.G("Remote '%s' doesn't support the %s architecture (supported: %s)"), remote, architecture, strings.Join(supported, ", "))
+		return exitError{err, copyExitArchitecture}
+	}
+
+	fmt.Fprintf(os.Stderr, i18n.G("Remote '%s' doesn't support the %s architecture (supported: %s), the container may not start there")+"\n", remote, architecture, strings.Join(supported, ", "))
+	return nil
+}
+
+// matchProfileNames replaces the profiles by the available one with the same
+// name regardless of case and surrounding spaces, if any
+func matchProfileNames(profiles []string, available []string) []string {
+	matched := []string{}
+	for _, profile := range profiles {
+		name := strings.TrimSpace(profile)
+		for _, candidate := range available {
+			if strings.EqualFold(name, candidate) {
+				name = candidate
+				break
+			}
+		}
+
+		matched = append(matched, name)
+	}
+
+	return matched
+}
+
+// runHook runs a --pre-hook or --post-hook command in a container of d
+func runHook(d *lxd.Client, name string, hook string) error {
+	stdin := ioutil.NopCloser(bytes.NewReader(nil))
+	ret, err := d.Exec(name, []string{"/bin/sh", "-c", hook}, nil, stdin, os.Stderr, os.Stderr, nil, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if ret != 0 {
+		return fmt.Errorf(i18n.G("exit code %d"), ret)
+	}
+
+	return nil
+}
+
+// startCopy starts the new container unless it's already running, as after
+// a stateful copy
+func (c *copyCmd) startCopy(d *lxd.Client, destName string, resp *api.Response) error {
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	ct, err := d.ContainerInfo(destName)
+	if err != nil {
+		return err
+	}
+
+	if ct.IsActive() {
+		return nil
+	}
+
+	resp, err = d.Action(destName, shared.Start, -1, false, false)
+	if err != nil {
+		return err
+	}
+
+	return d.WaitForSuccess(resp.Operation)
+}
+
+// autoName returns the name --auto-name tries at the given index
+func autoName(name string, index int) string {
+	if index == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s-%d", name, index)
+}
+
+// nextFreeName returns the first name from the given index on which isn't
+// used by a container of d, along with its index
+func nextFreeName(d *lxd.Client, name string, index int) (string, int, error) {
+	for i := index; i < index+copyAutoNameMax; i++ {
+		candidate := autoName(name, i)
+		_, err := d.ContainerInfo(candidate)
+		if err == lxd.LXDErrors[http.StatusNotFound] {
+			return candidate, i, nil
+		}
+
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	return "", 0, fmt.Errorf(i18n.G("No free name found for '%s'"), name)
+}
+
+// nameCollision returns whether the copy failed because the destination
+// container already exists
+func nameCollision(err error) bool {
+	return err == lxd.LXDErrors[http.StatusConflict]
+}
+
+// targetClient returns the client creating the new container on the server
+// of d, scoped to the project it's created in
+func (c *copyCmd) targetClient(d *lxd.Client) *lxd.Client {
+	if c.targetProject == "" {
+		return d
+	}
+
+	return d.UseProject(c.targetProject)
+}
+
+// checkProfiles makes sure that all the profiles exist on the target
+func (c *copyCmd) checkProfiles(d *lxd.Client, profiles []string) error {
+	missing, err := d.MissingProfiles(profiles)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	err = fmt.Errorf(i18n.G("The following profiles don't exist on the target: %s"), strings.Join(missing, ", "))
+	return exitError{err, copyExitProfiles}
+}
+
+// copyDone reports the new container, its name is shown when it was picked
+// by the server or --print-name was passed, unless machine-readable output
+// was requested.
+func (c *copyCmd) copyDone(sourceRemote string, sourceName string, destName string, resp *api.Response, migrated bool, stats copyStats) error {
+	if c.quiet {
+		return nil
+	}
+
+	if destName == "" || c.printName {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+
+		if c.printName && c.format != listFormatJSON {
+			fmt.Println(destName)
+		} else if c.format != listFormatJSON {
+			fmt.Printf(i18n.G("Container name is: %s")+"\n", destName)
+		}
+	}
+
+	// The summary would get in the way of scripts reading the name
+	if !c.printName && c.format != listFormatJSON {
+		duration := stats.duration - stats.duration%(100*time.Millisecond)
+		if stats.bytes > 0 && stats.duration > 0 {
+			rate := int64(float64(stats.bytes) / stats.duration.Seconds())
+			fmt.Printf(i18n.G("Transferred %s in %s (%s/s)")+"\n", shared.GetByteSizeString(stats.bytes, 2), duration, shared.GetByteSizeString(rate, 2))
+		} else {
+			fmt.Printf(i18n.G("Copied in %s")+"\n", duration)
+		}
+
+		if c.stateful {
+			fmt.Printf(i18n.G("Stateful: %v")+"\n", stats.stateful)
+		}
+
+		if c.start {
+			fmt.Printf(i18n.G("Started: %v")+"\n", stats.started)
+		}
+	}
+
+	if c.format == listFormatJSON {
+		result := copyResult{
+			Container: destName,
+			Source:    fmt.Sprintf("%s:%s", sourceRemote, sourceName),
+			Migrated:  migrated,
+			Duration:  stats.duration.Seconds(),
+			Bytes:     stats.bytes,
+			Stateful:  stats.stateful,
+			Started:   stats.started,
+			Operation: resp.Operation,
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		err := enc.Encode(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyStarted reports the operations of a copy started with --wait=false
+func (c *copyCmd) copyStarted(sourceRemote string, sourceName string, resp *api.Response, migrated bool) error {
+	if c.quiet {
+		return nil
+	}
+
+	if c.format == listFormatJSON {
+		result := copyStartedResult{
+			Source:    fmt.Sprintf("%s:%s", sourceRemote, sourceName),
+			Migrated:  migrated,
+			Operation: resp.Operation,
+		}
+
+		if migrated {
+			result.SourceOperation = c.sourceOperation
+		}
+
+		return json.NewEncoder(os.Stdout).Encode(result)
+	}
+
+	if !migrated {
+		fmt.Printf(i18n.G("Copy started, operation: %s")+"\n", resp.Operation)
+		return nil
+	}
+
+	fmt.Printf(i18n.G("Copy started, destination operation: %s, source operation: %s")+"\n", resp.Operation, c.sourceOperation)
+	return nil
+}
+
+// publishCopy publishes the new container as an image of its remote and
+// deletes it, returning the fingerprint of the image.
+func (c *copyCmd) publishCopy(d *lxd.Client, destName string, resp *api.Response) (string, error) {
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fingerprint, pubErr := d.ImageFromContainer(destName, false, c.imageAliases, nil, "")
+
+	// The container was only needed to get the image
+	resp, err := d.Delete(destName)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if pubErr != nil {
+		return "", pubErr
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the container '%s' used to publish the image: %s")+"\n", destName, err)
+	}
+
+	return fingerprint, nil
+}
+
+// imageDone reports the image published with --to-image
+func (c *copyCmd) imageDone(sourceRemote string, sourceName string, fingerprint string, migrated bool, stats copyStats) error {
+	if c.quiet {
+		return nil
+	}
+
+	if c.format != listFormatJSON {
+		fmt.Printf(i18n.G("Container published with fingerprint: %s")+"\n", fingerprint)
+		return nil
+	}
+
+	result := copyResult{
+		Image:    fingerprint,
+		Source:   fmt.Sprintf("%s:%s", sourceRemote, sourceName),
+		Migrated: migrated,
+		Duration: stats.duration.Seconds(),
+		Bytes:    stats.bytes,
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+// exportToFile exports the source container or snapshot to a tarball by
+// publishing it as a temporary image of its remote
+func (c *copyCmd) exportToFile(source *lxd.Client, sourceRemote string, sourceName string) error {
+	start := time.Now()
+
+	fingerprint, err := source.ImageFromContainer(sourceName, false, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf(i18n.G("Unable to export '%s': %s"), sourceName, err)
+	}
+
+	defer func() {
+		err := source.DeleteImage(fingerprint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the image '%s' used for the export: %s")+"\n", fingerprint, err)
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "lxc_copy_")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Exporting to a directory keeps the file name of the server
+	exported, err := source.ExportImage(fingerprint, dir)
+	if err != nil {
+		return err
+	}
+
+	if exported == dir {
+		return fmt.Errorf(i18n.G("The export of '%s' is split in several files"), sourceName)
+	}
+
+	err = shared.FileMove(exported, c.toFile)
+	if err != nil {
+		return err
+	}
+
+	if c.quiet {
+		return nil
+	}
+
+	if c.format != listFormatJSON {
+		fmt.Printf(i18n.G("Container exported to %s")+"\n", c.toFile)
+		return nil
+	}
+
+	result := copyResult{
+		File:     c.toFile,
+		Source:   fmt.Sprintf("%s:%s", sourceRemote, sourceName),
+		Duration: time.Since(start).Seconds(),
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+// importFromFile creates the destination container from a tarball exported
+// with --to-file, which is imported as a temporary image of the destination
+func (c *copyCmd) importFromFile(config *lxd.Config, destResource string, ephemeral *bool) error {
+	destRemote, destName := config.ParseRemoteAndContainer(destResource)
+	_, err := config.ResolveRemote(destRemote)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(c.fromFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = checkExportTarball(f)
+	if err != nil {
+		return fmt.Errorf(i18n.G("'%s' isn't an LXD export: %s"), c.fromFile, err)
+	}
+
+	// The fingerprint of an image is the hash of its tarball
+	_, err = f.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+	d, err := c.newClient(config, destRemote)
+	if err != nil {
+		return err
+	}
+	d = c.targetClient(d)
+
+	start := time.Now()
+
+	// Only remove the image when it wasn't already there
+	_, err = d.GetImageInfo(fingerprint)
+	if err != nil {
+		_, err = d.PostImage(c.fromFile, "", nil, false, nil, nil)
+		if err != nil {
+			return fmt.Errorf(i18n.G("The destination refused the import of '%s': %s"), c.fromFile, err)
+		}
+
+		defer func() {
+			err := d.DeleteImage(fingerprint)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, i18n.G("Failed to delete the image '%s' used for the import: %s")+"\n", fingerprint, err)
+			}
+		}()
+	}
+
+	var profiles *[]string
+	if c.profArgs != nil {
+		list := []string(c.profArgs)
+		profiles = &list
+	}
+
+	containerConfig := map[string]string{}
+	for _, entry := range c.confArgs {
+		items := strings.SplitN(entry, "=", 2)
+		containerConfig[items[0]] = items[1]
+	}
+
+	resp, err := d.Init(destName, destRemote, fingerprint, profiles, containerConfig, nil, ephemeral != nil && *ephemeral)
+	if err == nil {
+		err = d.WaitForSuccess(resp.Operation)
+	}
+
+	if err != nil {
+		return fmt.Errorf(i18n.G("Unable to create the container from '%s': %s"), c.fromFile, err)
+	}
+
+	return c.copyDone("file", c.fromFile, destName, resp, false, copyStats{duration: time.Since(start)})
+}
+
+// checkExportTarball makes sure that a file looks like an export, that is a
+// tarball with a metadata.yaml. Compressions which can't be read here are
+// left to the server to check.
+func checkExportTarball(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	header, err := reader.Peek(263)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	var content io.Reader
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		content, err = gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+	case bytes.HasPrefix(header, []byte{'B', 'Z'}):
+		content = bzip2.NewReader(reader)
+	case len(header) > 5 && bytes.Equal(header[1:5], []byte{'7', 'z', 'X', 'Z'}):
+		return nil
+	case len(header) >= 262 && bytes.Equal(header[257:262], []byte{'u', 's', 't', 'a', 'r'}):
+		content = reader
+	default:
+		return fmt.Errorf(i18n.G("unknown file format"))
+	}
+
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf(i18n.G("no metadata.yaml in the tarball"))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimPrefix(hdr.Name, "./") == "metadata.yaml" {
+			return nil
+		}
+	}
+}
+
+// transferredBytes returns how much data the destination received for a
+// migration, or 0 when the server doesn't report it.
+func transferredBytes(d *lxd.Client, resp *api.Response) int64 {
+	return operationBytes(d, resp.Operation)
+}
+
+// operationBytes returns how many bytes the migration operation received so
+// far, 0 when it doesn't report it
+func operationBytes(d *lxd.Client, operation string) int64 {
+	op, err := d.GetOperation(operation)
+	if err != nil {
+		return 0
+	}
+
+	transfers, ok := op.Metadata["fs_progress_bytes"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	total := int64(0)
+	for _, transferred := range transfers {
+		bytes, ok := transferred.(float64)
+		if ok {
+			total += int64(bytes)
+		}
+	}
+
+	return total
+}
+
+// copiedName returns the name of the new container from the resources of the
+// copy operation.
+func copiedName(resp *api.Response) (string, error) {
+	op, err := resp.MetadataAsOperation()
+	if err != nil {
+		return "", fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+": %s (metadata: %s)", err, rawMetadata(resp))
+	}
+
+	containers, ok := op.Resources["containers"]
+	if !ok || len(containers) == 0 {
+		return "", fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+" (metadata: %s)", rawMetadata(resp))
+	}
+
+	fields := strings.Split(containers[0], "/")
+	return fields[len(fields)-1], nil
+}
+
+// verifyCopy compares the checksums of all files in the source and the new
+// container, the new container is left in place on mismatch.
+func (c *copyCmd) verifyCopy(source *lxd.Client, sourceName string, dest *lxd.Client, destName string, resp *api.Response) error {
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Infof("Verifying the content of %s against %s", destName, sourceName)
+
+	sourceManifest, err := checksumManifest(source, sourceName)
+	if err != nil {
+		return err
+	}
+
+	destManifest, err := checksumManifest(dest, destName)
+	if err != nil {
+		return err
+	}
+
+	mismatch := manifestDiff(sourceManifest, destManifest)
+	if len(mismatch) > 0 {
+		return fmt.Errorf(i18n.G("The content of '%s' doesn't match the source, it was left in place for inspection. Differing paths:")+"\n  %s", destName, strings.Join(mismatch, "\n  "))
+	}
+
+	return nil
+}
+
+// resolveSnapshotSelector returns the name of the snapshot picked by an
+// "@latest" or "@oldest" selector
+func resolveSnapshotSelector(snapshots []api.ContainerSnapshot, selector string) (string, error) {
+	if selector != "@latest" && selector != "@oldest" {
+		return "", fmt.Errorf(i18n.G("unknown snapshot selector '%s', must be @latest or @oldest"), selector)
+	}
+
+	if len(snapshots) == 0 {
+		return "", fmt.Errorf(i18n.G("no snapshot to copy"))
+	}
+
+	picked := snapshots[0]
+	for _, snapshot := range snapshots[1:] {
+		if selector == "@latest" && snapshot.CreationDate.After(picked.CreationDate) {
+			picked = snapshot
+		} else if selector == "@oldest" && snapshot.CreationDate.Before(picked.CreationDate) {
+			picked = snapshot
+		}
+	}
+
+	return picked.Name, nil
+}
+
+// snapshotRenameMap maps the snapshot names to their new name following the
+// --snapshot-rename pattern.
+func snapshotRenameMap(pattern string, snapshots []string, now time.Time) (map[string]string, error) {
+	renames := map[string]string{}
+	used := map[string]string{}
+
+	for _, snapshot := range snapshots {
+		newName := strings.Replace(pattern, "{name}", snapshot, -1)
+		newName = strings.Replace(newName, "{date}", now.Format("20060102"), -1)
+
+		if newName == "" || strings.Contains(newName, "/") {
+			return nil, fmt.Errorf(i18n.G("Invalid snapshot name '%s' from pattern '%s'"), newName, pattern)
+		}
+
+		other, ok := used[newName]
+		if ok {
+			return nil, fmt.Errorf(i18n.G("Snapshots '%s' and '%s' would both be renamed to '%s'"), other, snapshot, newName)
+		}
+
+		if newName != snapshot && shared.StringInSlice(newName, snapshots) {
+			return nil, fmt.Errorf(i18n.G("Snapshot '%s' can't be renamed to '%s', a snapshot of that name already exists"), snapshot, newName)
+		}
+
+		used[newName] = snapshot
+		renames[snapshot] = newName
+	}
+
+	return renames, nil
+}
+
+// pruneSnapshots deletes the snapshots of the new container which weren't
+// asked for with --snapshot.
+func (c *copyCmd) pruneSnapshots(d *lxd.Client, destName string, resp *api.Response) error {
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshots, err := d.ListSnapshots(destName)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		fields := strings.SplitN(snapshot.Name, shared.SnapshotDelimiter, 2)
+		if shared.StringInSlice(fields[len(fields)-1], c.snapshots) {
+			continue
+		}
+
+		resp, err := d.Delete(destName + shared.SnapshotDelimiter + fields[len(fields)-1])
+		if err != nil {
+			return err
+		}
+
+		err = d.WaitForSuccess(resp.Operation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameSnapshots renames the snapshots of the new container.
+func (c *copyCmd) renameSnapshots(d *lxd.Client, destName string, resp *api.Response, renames map[string]string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	for oldName, newName := range renames {
+		if oldName == newName {
+			continue
+		}
+
+		resp, err := d.Rename(destName+shared.SnapshotDelimiter+oldName, destName+shared.SnapshotDelimiter+newName)
+		if err != nil {
+			return err
+		}
+
+		err = d.WaitForSuccess(resp.Operation)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setDescription sets the description of the new container. Containers are
+// created with the description of their source, so this is done once the
+// copy completed.
+func (c *copyCmd) setDescription(d *lxd.Client, destName string, resp *api.Response) error {
+	if !c.description.set {
+		return nil
+	}
+
+	if destName == "" {
+		var err error
+		destName, err = copiedName(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	ct, err := d.ContainerInfo(destName)
+	if err != nil {
+		return err
+	}
+
+	if ct.Description == c.description.value {
+		return nil
+	}
+
+	put := ct.Writable()
+	put.Description = c.description.value
+
+	return d.UpdateContainerConfig(destName, put)
+}
+
+// checksumManifest walks the filesystem of a stopped container through the
+// file API and returns the SHA-256 of every file, keyed by path. Entries
+// which can't be read are recorded as such so they still get compared.
+func checksumManifest(d *lxd.Client, container string) (map[string]string, error) {
+	manifest := map[string]string{}
+
+	_, _, _, type_, _, entries, err := d.PullFile(container, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	if type_ != "directory" {
+		return nil, fmt.Errorf(i18n.G("Unable to list the root of '%s'"), container)
+	}
+
+	var walk func(dir string, entries []string, parents []string)
+	walk = func(dir string, entries []string, parents []string) {
+		// The file API follows symlinks, a directory listing identical
+		// to one of its parents is a symlink loop.
+		sort.Strings(entries)
+		listing := strings.Join(entries, "/")
+		if shared.StringInSlice(listing, parents) {
+			return
+		}
+		parents = append(parents, listing)
+
+		for _, entry := range entries {
+			p := path.Join(dir, entry)
+
+			_, _, _, type_, buf, children, err := d.PullFile(container, p)
+			if err != nil {
+				manifest[p] = "unreadable"
+				continue
+			}
+
+			if type_ == "directory" {
+				walk(p, children, parents)
+				continue
+			}
+
+			hash := sha256.New()
+			_, err = io.Copy(hash, buf)
+			buf.Close()
+			if err != nil {
+				manifest[p] = "unreadable"
+				continue
+			}
+
+			manifest[p] = fmt.Sprintf("%x", hash.Sum(nil))
+		}
+	}
+
+	walk("/", entries, nil)
+
+	return manifest, nil
+}
+
+// manifestDiff returns the sorted paths which are missing from either
+// manifest or have a different checksum.
+func manifestDiff(source map[string]string, dest map[string]string) []string {
+	diff := []string{}
+
+	for p, sum := range source {
+		if dest[p] != sum {
+			diff = append(diff, p)
+		}
+	}
+
+	for p := range dest {
+		_, ok := source[p]
+		if !ok {
+			diff = append(diff, p)
+		}
+	}
+
+	sort.Strings(diff)
+	return diff
+}
+
+// followCopyEvents prints the operation and logging events of d about the
+// container until done is closed
+func (c *copyCmd) followCopyEvents(d *lxd.Client, remote string, name string, done chan bool) {
+	statuses := map[string]string{}
+	handler := func(msg interface{}) {
+		event, ok := msg.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		md, ok := event["metadata"].(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		switch event["type"] {
+		case "operation":
+			if !eventAboutContainer(md, name) {
+				return
+			}
+
+			id, _ := md["id"].(string)
+			description, _ := md["description"].(string)
+			status, _ := md["status"].(string)
+
+			// Only the steps are of interest, not the progress updates
+			if statuses[id] == status {
+				return
+			}
+			statuses[id] = status
+
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", remote, description, status)
+		case "logging":
+			context, _ := md["context"].(map[string]interface{})
+			for _, value := range context {
+				if value == name {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", remote, md["message"])
+					return
+				}
+			}
+		}
+	}
+
+	go d.Monitor([]string{"operation", "logging"}, handler, done)
+}
+
+// eventAboutContainer returns whether the operation of an event has the
+// container among its resources
+func eventAboutContainer(md map[string]interface{}, name string) bool {
+	resources, ok := md["resources"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	containers, ok := resources["containers"].([]interface{})
+	if !ok {
+		return false
+	}
+
+	for _, container := range containers {
+		url, ok := container.(string)
+		if ok && strings.HasSuffix(url, "/containers/"+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watchIdle calls stalled when the migration operation didn't receive
+// anything for --timeout-idle, until done is closed. The time before the
+// first progress report, e.g. while the source freezes, isn't counted.
+func (c *copyCmd) watchIdle(d *lxd.Client, operation string, stalled func(), done chan bool) {
+	interval := c.timeoutIdle / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := int64(0)
+	var lastProgress time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		bytes := operationBytes(d, operation)
+		if bytes != last {
+			last = bytes
+			lastProgress = time.Now()
+			continue
+		}
+
+		if !lastProgress.IsZero() && time.Since(lastProgress) >= c.timeoutIdle {
+			stalled()
+			return
+		}
+	}
+}
+
+func (c *copyCmd) migrationProgressTracker(d *lxd.Client, progress *ProgressRenderer, operation string, done chan bool) {
+	handler := func(msg interface{}) {
+		if msg == nil {
+			return
+		}
+
+		event := msg.(map[string]interface{})
+		if event["type"].(string) != "operation" {
+			return
+		}
+
+		if event["metadata"] == nil {
+			return
+		}
+
+		md := event["metadata"].(map[string]interface{})
+		if !strings.HasSuffix(operation, md["id"].(string)) {
+			return
+		}
+
+		if md["metadata"] == nil {
+			return
+		}
+
+		if api.StatusCode(md["status_code"].(float64)).IsFinal() {
+			return
+		}
+
+		opMd := md["metadata"].(map[string]interface{})
+		_, ok := opMd["fs_progress"]
+		if ok {
+			progress.Update(opMd["fs_progress"].(string))
+		}
+	}
+	go d.Monitor([]string{"operation"}, handler, done)
+}
+
+func (c *copyCmd) run(config *lxd.Config, args []string) error {
+	if len(args) < 1 && c.batchFile == "" && c.fromFile == "" {
+		return errArgs
+	}
+
+	if len(args) > 0 && c.batchFile != "" {
 		return errArgs
 	}
 
-	ephem := 0
-	if c.ephem {
-		ephem = 1
+	if c.refresh && c.ephem {
+		return fmt.Errorf(i18n.G("--refresh can't be used with --ephemeral"))
+	}
+
+	// Renamed snapshots wouldn't match the source on the next refresh
+	if c.refresh && c.snapshotRename != "" {
+		return fmt.Errorf(i18n.G("--refresh can't be used with --snapshot-rename"))
+	}
+
+	if c.toImage && (c.refresh || c.stateful) {
+		return fmt.Errorf(i18n.G("--to-image can't be used with --refresh or --stateful"))
+	}
+
+	if !c.wait && (c.mode == "relay" || c.verify || c.toImage || c.snapshotRename != "" || c.description.set) {
+		return fmt.Errorf(i18n.G("--wait=false can't be used with --mode=relay, --verify, --to-image, --snapshot-rename or --description"))
+	}
+
+	if len(c.imageAliases) > 0 && !c.toImage {
+		return fmt.Errorf(i18n.G("--alias can only be used with --to-image"))
+	}
+
+	if (c.certFile == "") != (c.keyFile == "") {
+		return fmt.Errorf(i18n.G("--cert and --key must be used together"))
+	}
+
+	if c.certFile != "" {
+		cert, err := ioutil.ReadFile(c.certFile)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to read the client certificate '%s': %s"), c.certFile, err)
+		}
+
+		key, err := ioutil.ReadFile(c.keyFile)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to read the client key '%s': %s"), c.keyFile, err)
+		}
+
+		c.clientCert = string(cert)
+		c.clientKey = string(key)
+	}
+
+	if c.parallel < 1 {
+		return fmt.Errorf(i18n.G("Invalid parallel count %d, must be at least 1"), c.parallel)
+	}
+
+	if !shared.StringInSlice(c.mode, []string{"pull", "push", "relay"}) {
+		return fmt.Errorf(i18n.G("Invalid transfer mode '%s', must be one of pull, push or relay"), c.mode)
+	}
+
+	if c.limit != "" {
+		var rate int64
+		var err error
+		if strings.HasSuffix(c.limit, "bit") {
+			rate, err = shared.ParseBitSizeString(c.limit)
+			rate = rate / 8
+		} else {
+			rate, err = shared.ParseByteSizeString(c.limit)
+		}
+
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid transfer rate '%s': %s"), c.limit, err)
+		}
+
+		// rsync takes the limit in KiB/s
+		if rate < 1024 {
+			return fmt.Errorf(i18n.G("Invalid transfer rate '%s': must be at least 1kB"), c.limit)
+		}
+
+		c.bwlimit = fmt.Sprintf("%d", rate/1024)
+	}
+
+	switch c.compression {
+	case "", "none", "lz4", "zstd", "gzip":
+	default:
+		return fmt.Errorf(i18n.G("Invalid compression algorithm '%s', must be one of none, lz4, zstd or gzip"), c.compression)
+	}
+
+	if (c.preHook != "" || c.postHook != "") && c.dryRun {
+		return fmt.Errorf(i18n.G("--pre-hook and --post-hook can't be used with --dry-run"))
+	}
+
+	if c.postHook != "" && (!c.wait || c.toImage) {
+		return fmt.Errorf(i18n.G("--post-hook can't be used with --wait=false or --to-image"))
+	}
+
+	if c.expiry != "" {
+		if c.toImage {
+			return fmt.Errorf(i18n.G("--expiry can't be used with --to-image"))
+		}
+
+		var err error
+		c.expiryDate, err = parseExpiry(c.expiry, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.fromFile != "" && (len(args) > 1 || c.toFile != "" || c.batchFile != "" || c.toImage || c.refresh || c.stateful || c.dryRun) {
+		return fmt.Errorf(i18n.G("--from-file takes a single destination and can't be used with --to-file, --batch, --to-image, --refresh, --stateful or --dry-run"))
+	}
+
+	// The post-hook runs in the new container, which has to be running
+	if c.postHook != "" {
+		c.start = true
+	}
+
+	if c.start && (!c.wait || c.toImage || c.dryRun) {
+		return fmt.Errorf(i18n.G("--start can't be used with --wait=false, --to-image or --dry-run"))
+	}
+
+	if c.toFile != "" {
+		if len(args) != 1 || c.toImage || c.refresh || c.stateful || c.dryRun {
+			return fmt.Errorf(i18n.G("--to-file takes a single source and can't be used with --to-image, --refresh, --stateful or --dry-run"))
+		}
+	}
+
+	if c.manifest != "" {
+		if !c.wait || c.dryRun || c.toImage || c.toFile != "" || c.fromFile != "" {
+			return fmt.Errorf(i18n.G("--manifest can't be used with --wait=false, --dry-run, --to-image, --to-file or --from-file"))
+		}
+
+		if c.batchFile != "" || len(args) > 2 || (len(args) > 0 && isSourceGlob(args[0])) {
+			return fmt.Errorf(i18n.G("--manifest can only be used when copying a single container"))
+		}
+	}
+
+	if c.quiet && (c.dryRun || c.printName) {
+		return fmt.Errorf(i18n.G("--quiet can't be used with --dry-run or --print-name"))
+	}
+
+	if c.timeoutIdle < 0 {
+		return fmt.Errorf(i18n.G("--timeout-idle must be positive"))
+	}
+
+	if c.timeoutIdle > 0 && !c.wait {
+		return fmt.Errorf(i18n.G("--timeout-idle can't be used with --wait=false"))
+	}
+
+	if c.waitInterval != 0 {
+		if c.waitInterval < copyWaitIntervalMin || c.waitInterval > copyWaitIntervalMax {
+			return fmt.Errorf(i18n.G("--wait-interval must be between %s and %s"), copyWaitIntervalMin, copyWaitIntervalMax)
+		}
+
+		if !c.wait {
+			return fmt.Errorf(i18n.G("--wait-interval can't be used with --wait=false"))
+		}
+	}
+
+	if c.followEvents && !c.wait {
+		return fmt.Errorf(i18n.G("--follow-events can't be used with --wait=false"))
+	}
+
+	if c.keepVolatile {
+		fmt.Fprintf(os.Stderr, i18n.G("Keeping the volatile keys, the new container has the same MAC addresses as its source and may conflict with it on the same network")+"\n")
+	}
+
+	if len(c.excludes) > 0 && !c.refresh {
+		return fmt.Errorf(i18n.G("--exclude can only be used with --refresh"))
+	}
+
+	if len(c.snapshots) > 0 && c.containerOnly {
+		return fmt.Errorf(i18n.G("--snapshot can't be used with --container-only"))
+	}
+
+	if c.backup && !c.replace {
+		return fmt.Errorf(i18n.G("--backup can only be used with --replace"))
+	}
+
+	if c.yes && !c.replace {
+		return fmt.Errorf(i18n.G("--yes can only be used with --replace"))
+	}
+
+	if c.replace && (c.refresh || c.autoName || !c.wait) {
+		return fmt.Errorf(i18n.G("--replace can't be used with --refresh, --auto-name or --wait=false"))
+	}
+
+	if c.autoName && c.refresh {
+		return fmt.Errorf(i18n.G("--auto-name can't be used with --refresh"))
+	}
+
+	if c.sourceSnapshotOnly {
+		if c.fromSnapshot != "" {
+			return fmt.Errorf(i18n.G("--source-snapshot-only can't be used with --from-snapshot"))
+		}
+
+		c.fromSnapshot = "latest"
+	}
+
+	if c.fromSnapshot != "" && c.fromSnapshot != "latest" && c.fromSnapshot != "oldest" {
+		return fmt.Errorf(i18n.G("Invalid snapshot selector '%s', must be latest or oldest"), c.fromSnapshot)
+	}
+
+	switch c.protocol {
+	case "", "rsync":
+	case "btrfs", "zfs":
+		if c.limit != "" || c.compression != "" {
+			return fmt.Errorf(i18n.G("--limit and --compression require --protocol rsync"))
+		}
+	default:
+		return fmt.Errorf(i18n.G("Invalid transfer protocol '%s', must be one of rsync, btrfs or zfs"), c.protocol)
+	}
+
+	if c.timeout == 0 && os.Getenv("LXD_COPY_TIMEOUT") != "" {
+		var err error
+		c.timeout, err = time.ParseDuration(os.Getenv("LXD_COPY_TIMEOUT"))
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid LXD_COPY_TIMEOUT: %s"), err)
+		}
+	}
+
+	if c.targetSpec != "" {
+		spec, err := parseTargetSpec(c.targetSpec)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid target spec: %s"), err)
+		}
+
+		set := map[string]bool{}
+		gnuflag.Visit(func(f *gnuflag.Flag) {
+			set[f.Name] = true
+		})
+
+		c.applyTargetSpec(spec, set)
+	}
+
+	if c.instanceType != "" {
+		var err error
+		c.instanceConfig, err = instanceTypeConfig(c.instanceType)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.format != "" && c.format != listFormatJSON {
+		return fmt.Errorf("invalid format %q", c.format)
+	}
+
+	if c.configFile != "" {
+		content, err := ioutil.ReadFile(c.configFile)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to read config file '%s': %s"), c.configFile, err)
+		}
+
+		err = yaml.Unmarshal(content, &c.fileConfig)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid config file '%s': %s"), c.configFile, err)
+		}
+	}
+
+	if c.profileFrom != "" && c.noProfiles {
+		return fmt.Errorf(i18n.G("--profile-from can't be used with --no-profiles"))
+	}
+
+	if c.specFile != "" {
+		var content []byte
+		var err error
+		if c.specFile == "-" {
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(c.specFile)
+		}
+
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to read container spec '%s': %s"), c.specFile, err)
+		}
+
+		c.spec = &api.ContainerPut{}
+		err = yaml.Unmarshal(content, c.spec)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid container spec '%s': %s"), c.specFile, err)
+		}
+	}
+
+	// Without --ephemeral the copy is ephemeral when its source is
+	var ephem *bool
+	gnuflag.Visit(func(f *gnuflag.Flag) {
+		if f.Name == "ephemeral" || f.Name == "e" {
+			ephem = &c.ephem
+		}
+	})
+
+	if c.fromFile != "" {
+		destResource := ""
+		if len(args) > 0 {
+			destResource = args[0]
+		}
+
+		return c.importFromFile(config, destResource, ephem)
+	}
+
+	if c.batchFile != "" {
+		content, err := ioutil.ReadFile(c.batchFile)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Unable to read batch file '%s': %s"), c.batchFile, err)
+		}
+
+		entries, err := parseCopyBatch(content)
+		if err != nil {
+			return fmt.Errorf(i18n.G("Invalid batch file '%s': %s"), c.batchFile, err)
+		}
+
+		return c.runBatch(config, entries, ephem)
+	}
+
+	// Copy the containers matching glob patterns like a batch
+	for _, arg := range args[:len(args)-1] {
+		if !isSourceGlob(arg) {
+			continue
+		}
+
+		if !strings.HasSuffix(args[len(args)-1], ":") {
+			return fmt.Errorf(i18n.G("Glob patterns can only be copied to a remote (\"<remote>:\")"))
+		}
+
+		entries, err := c.expandSourceGlobs(config, args[:len(args)-1], args[len(args)-1])
+		if err != nil {
+			return err
+		}
+
+		return c.runBatch(config, entries, ephem)
 	}
 
 	if len(args) < 2 {
-		return c.copyContainer(config, args[0], "", false, ephem, false, c.containerOnly)
+		if isSourceGlob(args[0]) {
+			return fmt.Errorf(i18n.G("Glob patterns can only be copied to a remote (\"<remote>:\")"))
+		}
+
+		return c.copyContainer(config, args[0], "", c.keepVolatile, ephem, c.stateful, c.containerOnly)
+	}
+
+	if len(args) == 2 {
+		return c.copyContainer(config, args[0], args[1], c.keepVolatile, ephem, c.stateful, c.containerOnly)
+	}
+
+	// Multiple sources can only be copied to a remote, keeping their names
+	destResource := args[len(args)-1]
+	if !strings.HasSuffix(destResource, ":") {
+		return errArgs
+	}
+
+	// Each copy gets its own command, and so its own clients
+	sources := args[:len(args)-1]
+	errs := runCopyJobs(c.parallel, len(sources), func(i int) error {
+		cpy := *c
+		return cpy.copyContainer(config, sources[i], destResource, c.keepVolatile, ephem, c.stateful, c.containerOnly)
+	})
+
+	success := true
+	for i, sourceResource := range sources {
+		err := errs[i]
+		if err == nil {
+			continue
+		}
+
+		success = false
+		msg := fmt.Sprintf(i18n.G("error: %v"), err)
+		for _, line := range strings.Split(msg, "\n") {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("%s: %s", sourceResource, line))
+		}
+	}
+
+	if !success {
+		fmt.Fprintln(os.Stderr, "")
+		return fmt.Errorf(i18n.G("Some containers failed to copy"))
 	}
 
-	return c.copyContainer(config, args[0], args[1], false, ephem, false, c.containerOnly)
+	return nil
 }
@@ -0,0 +1,1127 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared/api"
+)
+
+func TestInstanceTypeConfig(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		cpu          string
+		memory       string
+		valid        bool
+	}{
+		{"c2-m4", "2", "4096MB", true},
+		{"c1-m0.5", "1", "512MB", true},
+		{"c0-m4", "", "", false},
+		{"c2-m0", "", "", false},
+		{"c2", "", "", false},
+		{"m4-c2", "", "", false},
+		{"t2.micro", "", "", false},
+	}
+
+	for _, test := range tests {
+		config, err := instanceTypeConfig(test.instanceType)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error state: %v", test.instanceType, err)
+			continue
+		}
+
+		if !test.valid {
+			continue
+		}
+
+		if config["limits.cpu"] != test.cpu || config["limits.memory"] != test.memory {
+			t.Errorf("%s: got %v", test.instanceType, config)
+		}
+	}
+}
+
+func TestParseCopyDestination(t *testing.T) {
+	config := &lxd.Config{
+		DefaultRemote: "local",
+		Remotes: map[string]lxd.RemoteConfig{
+			"local": lxd.LocalRemote,
+			"prod":  {Addr: "https://prod:8443"},
+		},
+	}
+
+	tests := []struct {
+		destResource string
+		sourceName   string
+		remote       string
+		name         string
+	}{
+		{"", "c1", "local", ""},
+		{"c2", "c1", "local", "c2"},
+		{"local:", "c1", "local", "c1"},
+		{"local:c2", "c1", "local", "c2"},
+		{"prod:", "c1", "prod", "c1"},
+		{"prod:c2", "c1", "prod", "c2"},
+		{"prod:", "c1/snap0", "prod", "c1"},
+		{"prod:c2", "c1/snap0", "prod", "c2"},
+	}
+
+	for _, test := range tests {
+		remote, name := parseCopyDestination(config, test.destResource, test.sourceName)
+		if remote != test.remote || name != test.name {
+			t.Errorf("%q from %q: got %s:%s, expected %s:%s", test.destResource, test.sourceName, remote, name, test.remote, test.name)
+		}
+	}
+}
+
+func TestManifestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		source map[string]string
+		dest   map[string]string
+		diff   []string
+	}{
+		{"identical", map[string]string{"/a": "1", "/b": "2"}, map[string]string{"/a": "1", "/b": "2"}, []string{}},
+		{"changed", map[string]string{"/a": "1", "/b": "2"}, map[string]string{"/a": "1", "/b": "3"}, []string{"/b"}},
+		{"missing", map[string]string{"/a": "1", "/b": "2"}, map[string]string{"/a": "1"}, []string{"/b"}},
+		{"extra", map[string]string{"/b": "2"}, map[string]string{"/a": "1", "/b": "2"}, []string{"/a"}},
+		{"unreadable", map[string]string{"/a": "unreadable"}, map[string]string{"/a": "unreadable"}, []string{}},
+	}
+
+	for _, test := range tests {
+		diff := manifestDiff(test.source, test.dest)
+		if strings.Join(diff, ",") != strings.Join(test.diff, ",") {
+			t.Errorf("%s: got %v, expected %v", test.name, diff, test.diff)
+		}
+	}
+}
+
+func TestSnapshotRenameMap(t *testing.T) {
+	now := time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pattern   string
+		snapshots []string
+		renames   map[string]string
+		valid     bool
+	}{
+		{"{date}-{name}", []string{"snap0", "snap1"}, map[string]string{"snap0": "20170714-snap0", "snap1": "20170714-snap1"}, true},
+		{"old-{name}", []string{"snap0"}, map[string]string{"snap0": "old-snap0"}, true},
+		{"{name}", []string{"snap0"}, map[string]string{"snap0": "snap0"}, true},
+		{"{date}", []string{"snap0"}, map[string]string{"snap0": "20170714"}, true},
+		{"{date}", []string{"snap0", "snap1"}, nil, false},
+		{"a/{name}", []string{"snap0"}, nil, false},
+		{"snap1", []string{"snap0", "snap1"}, nil, false},
+	}
+
+	for _, test := range tests {
+		renames, err := snapshotRenameMap(test.pattern, test.snapshots, now)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error state: %v", test.pattern, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(renames, test.renames) {
+			t.Errorf("%s: got %v, expected %v", test.pattern, renames, test.renames)
+		}
+	}
+}
+
+func TestCopyMapsAreIndependent(t *testing.T) {
+	ct := api.Container{}
+	ct.Config = map[string]string{"user.foo": "bar", "volatile.base_image": "abc"}
+	ct.Devices = map[string]map[string]string{"root": {"type": "disk", "path": "/"}}
+
+	config := copyConfigMap(ct.Config)
+	delete(config, "volatile.base_image")
+	config["user.foo"] = "baz"
+
+	devices := copyDevicesMap(ct.Devices)
+	devices["root"]["pool"] = "other"
+	devices["eth0"] = map[string]string{"type": "nic"}
+
+	if !reflect.DeepEqual(ct.Config, map[string]string{"user.foo": "bar", "volatile.base_image": "abc"}) {
+		t.Errorf("Source config was modified: %v", ct.Config)
+	}
+
+	if !reflect.DeepEqual(ct.Devices, map[string]map[string]string{"root": {"type": "disk", "path": "/"}}) {
+		t.Errorf("Source devices were modified: %v", ct.Devices)
+	}
+
+	if copyConfigMap(nil) == nil || copyDevicesMap(nil) == nil {
+		t.Errorf("Copies of nil maps must be writable")
+	}
+}
+
+func TestCopyPlanKeepsContainerInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/containers/c1" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1", "architecture": "x86_64", "config": {"user.foo": "bar", "volatile.base_image": "abc"}, "devices": {"root": {"type": "disk", "path": "/"}}, "profiles": ["default"]}}`)
+	}))
+	defer server.Close()
+
+	d := &lxd.Client{Name: "local", BaseURL: server.URL, Remote: &lxd.RemoteConfig{}}
+	ct, err := d.ContainerInfo("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := map[string]string{"user.foo": "bar", "volatile.base_image": "abc"}
+	devices := map[string]map[string]string{"root": {"type": "disk", "path": "/"}}
+	if !reflect.DeepEqual(ct.Config, config) || !reflect.DeepEqual(ct.Devices, devices) {
+		t.Fatalf("unexpected container info: %v, %v", ct.Config, ct.Devices)
+	}
+
+	// The source is used as copyContainer fetched it
+	cmd := copyCmd{confArgs: configList{"user.foo=baz"}, deviceArgs: deviceList{"eth0,type=nic"}, storagePool: "other"}
+	source := copySource{
+		Remote:       "local",
+		Architecture: ct.Architecture,
+		Config:       ct.Config,
+		Devices:      ct.Devices,
+		Expanded:     ct.ExpandedDevices,
+		Profiles:     ct.Profiles,
+	}
+
+	plan, err := cmd.computeCopyPlan(source, copyDestination{Remote: "remote"}, nil, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Config["user.foo"] != "baz" || plan.Devices["root"]["pool"] != "other" || plan.Devices["eth0"] == nil {
+		t.Errorf("the options weren't applied: %v, %v", plan.Config, plan.Devices)
+	}
+
+	if !reflect.DeepEqual(ct.Config, config) {
+		t.Errorf("the fetched config was modified: %v", ct.Config)
+	}
+
+	if !reflect.DeepEqual(ct.Devices, devices) {
+		t.Errorf("the fetched devices were modified: %v", ct.Devices)
+	}
+
+	if !reflect.DeepEqual(ct.Profiles, []string{"default"}) {
+		t.Errorf("the fetched profiles were modified: %v", ct.Profiles)
+	}
+}
+
+func TestParseDeviceOverride(t *testing.T) {
+	tests := []struct {
+		value  string
+		name   string
+		values map[string]string
+		valid  bool
+	}{
+		{"eth0,parent=br1", "eth0", map[string]string{"parent": "br1"}, true},
+		{"root,pool=ssd,size=10GB", "root", map[string]string{"pool": "ssd", "size": "10GB"}, true},
+		{"data,source=", "data", map[string]string{"source": ""}, true},
+		{"eth0", "", nil, false},
+		{",parent=br1", "", nil, false},
+		{"eth0,parent", "", nil, false},
+		{"eth0,=br1", "", nil, false},
+	}
+
+	for _, test := range tests {
+		name, values, err := parseDeviceOverride(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error state: %v", test.value, err)
+			continue
+		}
+
+		if err != nil && !strings.Contains(err.Error(), test.value) {
+			t.Errorf("%s: error doesn't name the device: %v", test.value, err)
+		}
+
+		if name != test.name || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%s: got %s %v", test.value, name, values)
+		}
+	}
+}
+
+func TestCopyEphemeral(t *testing.T) {
+	yes := true
+	no := false
+
+	tests := []struct {
+		requested *bool
+		source    bool
+		expected  bool
+	}{
+		{nil, false, false},
+		{nil, true, true},
+		{&yes, false, true},
+		{&yes, true, true},
+		{&no, false, false},
+		{&no, true, false},
+	}
+
+	for _, test := range tests {
+		ephemeral := copyEphemeral(test.requested, test.source)
+		if ephemeral != test.expected {
+			t.Errorf("requested %v, source %v: got %v, expected %v", test.requested, test.source, ephemeral, test.expected)
+		}
+	}
+}
+
+func TestRootfsOnlyConfig(t *testing.T) {
+	config := map[string]string{
+		"image.os":                "Ubuntu",
+		"limits.cpu":              "2",
+		"user.foo":                "bar",
+		"volatile.base_image":     "abcd",
+		"volatile.eth0.hwaddr":    "00:16:3e:00:00:01",
+		"security.privileged":     "true",
+		"environment.http_proxy":  "http://proxy",
+		"image.architecture.name": "amd64",
+	}
+
+	expected := map[string]string{
+		"image.os":                "Ubuntu",
+		"volatile.base_image":     "abcd",
+		"volatile.eth0.hwaddr":    "00:16:3e:00:00:01",
+		"image.architecture.name": "amd64",
+	}
+
+	kept := rootfsOnlyConfig(config)
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("got %v, expected %v", kept, expected)
+	}
+}
+
+func TestParseCopyBatch(t *testing.T) {
+	tests := []struct {
+		content string
+		entries []copyBatchEntry
+		err     bool
+	}{
+		{"", []copyBatchEntry{}, false},
+		{"- source: c1\n", []copyBatchEntry{{Source: "c1"}}, false},
+		{
+			"- source: c1\n  dest: remote:c2\n  profiles: [web]\n  config:\n    limits.cpu: \"2\"\n",
+			[]copyBatchEntry{{Source: "c1", Dest: "remote:c2", Profiles: []string{"web"}, Config: map[string]string{"limits.cpu": "2"}}},
+			false,
+		},
+		{"- dest: remote:c2\n", nil, true},
+		{"source: c1\n", nil, true},
+	}
+
+	for _, test := range tests {
+		entries, err := parseCopyBatch([]byte(test.content))
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.content)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.content, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(entries, test.entries) {
+			t.Errorf("%q: got %v, expected %v", test.content, entries, test.entries)
+		}
+	}
+}
+
+func TestRunCopyJobs(t *testing.T) {
+	var lock sync.Mutex
+	running := 0
+	maxRunning := 0
+
+	errs := runCopyJobs(2, 6, func(i int) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+
+		if i%2 == 1 {
+			return fmt.Errorf("job %d failed", i)
+		}
+
+		return nil
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("%d jobs ran at the same time, expected at most 2", maxRunning)
+	}
+
+	if len(errs) != 6 {
+		t.Fatalf("got %d errors, expected 6", len(errs))
+	}
+
+	for i, err := range errs {
+		if (i%2 == 1) != (err != nil) {
+			t.Errorf("job %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestResolveSnapshotSelector(t *testing.T) {
+	now := time.Now()
+	snapshots := []api.ContainerSnapshot{
+		{Name: "c1/snap1", CreationDate: now.Add(-time.Hour)},
+		{Name: "c1/snap2", CreationDate: now},
+		{Name: "c1/snap0", CreationDate: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		snapshots []api.ContainerSnapshot
+		selector  string
+		name      string
+		err       bool
+	}{
+		{snapshots, "@latest", "c1/snap2", false},
+		{snapshots, "@oldest", "c1/snap0", false},
+		{snapshots, "@newest", "", true},
+		{nil, "@latest", "", true},
+	}
+
+	for _, test := range tests {
+		name, err := resolveSnapshotSelector(test.snapshots, test.selector)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.selector)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.selector, err)
+			continue
+		}
+
+		if name != test.name {
+			t.Errorf("%s: got %q, expected %q", test.selector, name, test.name)
+		}
+	}
+}
+
+func TestMatchProfileNames(t *testing.T) {
+	available := []string{"default", "Web", "db"}
+
+	tests := []struct {
+		profiles []string
+		matched  []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"default", "web"}, []string{"default", "Web"}},
+		{[]string{" DB ", "Default"}, []string{"db", "default"}},
+		{[]string{"missing"}, []string{"missing"}},
+	}
+
+	for _, test := range tests {
+		matched := matchProfileNames(test.profiles, available)
+		if !reflect.DeepEqual(matched, test.matched) {
+			t.Errorf("%v: got %v, expected %v", test.profiles, matched, test.matched)
+		}
+	}
+}
+
+func TestAutoName(t *testing.T) {
+	tests := []struct {
+		index int
+		name  string
+	}{
+		{0, "c1"},
+		{1, "c1-1"},
+		{12, "c1-12"},
+	}
+
+	for _, test := range tests {
+		name := autoName("c1", test.index)
+		if name != test.name {
+			t.Errorf("%d: got %q, expected %q", test.index, name, test.name)
+		}
+	}
+}
+
+func TestParseTargetSpec(t *testing.T) {
+	tests := []struct {
+		content string
+		spec    *copyTargetSpec
+		err     string
+	}{
+		{`{}`, &copyTargetSpec{}, ""},
+		{
+			`{"project": "dev", "pool": "ssd", "member": "node1", "instance_type": "c2-m4"}`,
+			&copyTargetSpec{Project: "dev", Pool: "ssd", Member: "node1", InstanceType: "c2-m4"},
+			"",
+		},
+		{`{"pools": "ssd"}`, nil, "pools"},
+		{`{"pool": 1}`, nil, "pool"},
+		{`{"project": ""}`, nil, "project"},
+		{`{"instance_type": "big"}`, nil, "instance_type"},
+		{`[]`, nil, ""},
+	}
+
+	for _, test := range tests {
+		spec, err := parseTargetSpec(test.content)
+		if test.spec == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.content)
+			} else if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: error %q doesn't mention %q", test.content, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.content, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(spec, test.spec) {
+			t.Errorf("%s: got %v, expected %v", test.content, spec, test.spec)
+		}
+	}
+}
+
+func TestApplyTargetSpec(t *testing.T) {
+	spec := &copyTargetSpec{Project: "dev", Pool: "ssd", Member: "node1", InstanceType: "c2-m4"}
+
+	c := copyCmd{storagePool: "hdd", target: "node2"}
+	c.applyTargetSpec(spec, map[string]bool{"s": true, "target": true})
+
+	if c.targetProject != "dev" || c.instanceType != "c2-m4" {
+		t.Errorf("spec fields not applied: %+v", c)
+	}
+
+	if c.storagePool != "hdd" || c.target != "node2" {
+		t.Errorf("flags overridden by the spec: %+v", c)
+	}
+}
+
+func TestEventAboutContainer(t *testing.T) {
+	md := map[string]interface{}{
+		"resources": map[string]interface{}{
+			"containers": []interface{}{"/1.0/containers/c1", "/1.0/containers/c10"},
+		},
+	}
+
+	if !eventAboutContainer(md, "c1") {
+		t.Errorf("c1 not found in %v", md)
+	}
+
+	if eventAboutContainer(md, "c") {
+		t.Errorf("c found in %v", md)
+	}
+
+	if eventAboutContainer(map[string]interface{}{}, "c1") {
+		t.Errorf("c1 found without resources")
+	}
+}
+
+func TestParseIdmapEntry(t *testing.T) {
+	tests := []struct {
+		value string
+		entry string
+		err   bool
+	}{
+		{"1000:1000", "1000 1000", false},
+		{"1000-1999:0-999", "1000-1999 0-999", false},
+		{"1000-1999:0-99", "", true},
+		{"1000", "", true},
+		{"a:1", "", true},
+		{"10-5:5-10", "", true},
+		{"1:2:3", "", true},
+	}
+
+	for _, test := range tests {
+		entry, err := parseIdmapEntry(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error: %v", test.value, err)
+			continue
+		}
+
+		if entry != test.entry {
+			t.Errorf("%s: got %q, expected %q", test.value, entry, test.entry)
+		}
+	}
+}
+
+func TestReplaceBackupName(t *testing.T) {
+	now := time.Date(2017, 7, 4, 13, 5, 9, 0, time.FixedZone("", 3600))
+
+	name := replaceBackupName("c1", now)
+	if name != "c1-backup-20170704120509" {
+		t.Errorf("got %q", name)
+	}
+}
+
+func TestCopiedName(t *testing.T) {
+	tests := []struct {
+		metadata string
+		name     string
+		err      string
+	}{
+		{`{"resources": {"containers": ["/1.0/containers/c1"]}}`, "c1", ""},
+		{`{"resources": {"images": ["/1.0/images/abc"]}}`, "", `(metadata: {"resources": {"images": ["/1.0/images/abc"]}})`},
+		{`[1, 2]`, "", "(metadata: [1, 2])"},
+		{``, "", "(metadata: none)"},
+	}
+
+	for _, test := range tests {
+		name, err := copiedName(&api.Response{Metadata: []byte(test.metadata)})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, expected it to contain %q", test.metadata, err, test.err)
+			}
+
+			continue
+		}
+
+		if err != nil || name != test.name {
+			t.Errorf("%s: got (%q, %v), expected %q", test.metadata, name, err, test.name)
+		}
+	}
+}
+
+func TestMatchContainerNames(t *testing.T) {
+	containers := []api.Container{{Name: "web-2"}, {Name: "db-1"}, {Name: "web-1"}, {Name: "web"}}
+
+	tests := []struct {
+		pattern string
+		names   []string
+	}{
+		{"web-*", []string{"web-1", "web-2"}},
+		{"*-1", []string{"db-1", "web-1"}},
+		{"web-[2]", []string{"web-2"}},
+		{"app-*", []string{}},
+	}
+
+	for _, test := range tests {
+		names, err := matchContainerNames(containers, test.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", test.pattern, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%s: got %v, expected %v", test.pattern, names, test.names)
+		}
+	}
+
+	_, err := matchContainerNames(containers, "web-[")
+	if err == nil {
+		t.Errorf("web-[: expected an error")
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2017, 7, 4, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		expiry time.Time
+		err    bool
+	}{
+		{"12h", now.Add(12 * time.Hour), false},
+		{"7d", now.Add(7 * 24 * time.Hour), false},
+		{"2017-07-10", time.Date(2017, 7, 10, 0, 0, 0, 0, time.UTC), false},
+		{"2017-07-05T08:00:00Z", time.Date(2017, 7, 5, 8, 0, 0, 0, time.UTC), false},
+		{"2017-07-01", time.Time{}, true},
+		{"-1h", time.Time{}, true},
+		{"0d", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		expiry, err := parseExpiry(test.value, now)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error: %v", test.value, err)
+			continue
+		}
+
+		if !expiry.Equal(test.expiry) {
+			t.Errorf("%s: got %s, expected %s", test.value, expiry, test.expiry)
+		}
+	}
+}
+
+func TestPrependProfiles(t *testing.T) {
+	tests := []struct {
+		profiles []string
+		prepend  []string
+		result   []string
+	}{
+		{[]string{"default", "web"}, []string{"base"}, []string{"base", "default", "web"}},
+		{[]string{"default", "web"}, []string{"web", "base"}, []string{"web", "base", "default"}},
+		{[]string{}, []string{"base", "base"}, []string{"base"}},
+	}
+
+	for _, test := range tests {
+		result := prependProfiles(test.profiles, test.prepend)
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("%v + %v: got %v, expected %v", test.prepend, test.profiles, result, test.result)
+		}
+	}
+}
+
+func TestCheckExportTarball(t *testing.T) {
+	tarball := func(names ...string) []byte {
+		buf := bytes.Buffer{}
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg})
+		}
+		tw.Close()
+		return buf.Bytes()
+	}
+
+	compressed := bytes.Buffer{}
+	gw := gzip.NewWriter(&compressed)
+	gw.Write(tarball("metadata.yaml", "rootfs/"))
+	gw.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		valid   bool
+	}{
+		{"tar", tarball("./metadata.yaml", "./rootfs/"), true},
+		{"gzip", compressed.Bytes(), true},
+		{"xz", []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, true},
+		{"no metadata", tarball("rootfs/"), false},
+		{"text", []byte("hello"), false},
+	}
+
+	for _, test := range tests {
+		err := checkExportTarball(bytes.NewReader(test.content))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func TestRepointNICs(t *testing.T) {
+	devices := map[string]map[string]string{
+		"eth0": {"type": "nic", "nictype": "bridged", "parent": "lxdbr0"},
+		"root": {"type": "disk", "path": "/", "pool": "default"},
+	}
+
+	expanded := map[string]map[string]string{
+		"eth0": {"type": "nic", "nictype": "bridged", "parent": "lxdbr0"},
+		"eth1": {"type": "nic", "nictype": "macvlan", "parent": "eno1"},
+		"eth2": {"type": "nic", "nictype": "p2p"},
+		"root": {"type": "disk", "path": "/", "pool": "default"},
+	}
+
+	repointNICs(devices, expanded, "br1")
+
+	expected := map[string]map[string]string{
+		"eth0": {"type": "nic", "nictype": "bridged", "parent": "br1"},
+		"eth1": {"type": "nic", "nictype": "macvlan", "parent": "br1"},
+		"root": {"type": "disk", "path": "/", "pool": "default"},
+	}
+
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected %v, got %v", expected, devices)
+	}
+
+	// The profile itself is left alone
+	if expanded["eth1"]["parent"] != "eno1" {
+		t.Errorf("the device of the profile was modified")
+	}
+}
+
+func TestComputeCopyPlan(t *testing.T) {
+	yes := true
+	no := false
+
+	source := copySource{
+		Remote:       "local",
+		Architecture: "x86_64",
+		Config: map[string]string{
+			"limits.cpu":           "2",
+			"user.foo":             "bar",
+			"volatile.base_image":  "abcd",
+			"volatile.eth0.hwaddr": "00:16:3e:00:00:01",
+		},
+		Devices:   map[string]map[string]string{},
+		Profiles:  []string{"default"},
+		CreatedAt: time.Unix(1000, 0),
+		Ephemeral: true,
+	}
+
+	snapshot := source
+	snapshot.Snapshot = true
+
+	running := source
+	running.Running = true
+
+	tests := []struct {
+		name         string
+		cmd          copyCmd
+		source       copySource
+		dest         copyDestination
+		ephemeral    *bool
+		stateful     bool
+		keepVolatile bool
+		expected     copyPlan
+		err          bool
+	}{
+		{
+			name:   "local copy keeps the source as is",
+			source: source,
+			dest:   copyDestination{Remote: "local"},
+			expected: copyPlan{
+				Local:        true,
+				Architecture: "x86_64",
+				Config:       source.Config,
+				Devices:      map[string]map[string]string{},
+				Profiles:     []string{"default"},
+				Ephemeral:    true,
+			},
+		},
+		{
+			name:      "ephemeral can be turned off",
+			source:    source,
+			dest:      copyDestination{Remote: "remote"},
+			ephemeral: &no,
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config:       source.Config,
+				Devices:      map[string]map[string]string{},
+				Profiles:     []string{"default"},
+			},
+		},
+		{
+			name:      "a snapshot is copied without its siblings",
+			source:    snapshot,
+			dest:      copyDestination{Remote: "remote"},
+			ephemeral: &yes,
+			expected: copyPlan{
+				Architecture:  "x86_64",
+				Config:        source.Config,
+				Devices:       map[string]map[string]string{},
+				Profiles:      []string{"default"},
+				Ephemeral:     true,
+				ContainerOnly: true,
+			},
+		},
+		{
+			name:   "profiles of the remote and the options are merged",
+			cmd:    copyCmd{profArgs: profileList{"web"}, profPrepend: profileList{"base"}},
+			source: source,
+			dest:   copyDestination{Remote: "remote", Profiles: []string{"default", "net"}},
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config:       source.Config,
+				Devices:      map[string]map[string]string{},
+				Profiles:     []string{"base", "default", "net", "web"},
+				Ephemeral:    true,
+			},
+		},
+		{
+			name:   "no profiles drops the ones of the remote too",
+			cmd:    copyCmd{noProfiles: true},
+			source: source,
+			dest:   copyDestination{Remote: "remote", Profiles: []string{"net"}},
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config:       source.Config,
+				Devices:      map[string]map[string]string{},
+				Profiles:     []string{},
+				Ephemeral:    true,
+			},
+		},
+		{
+			name:         "volatile keys are only kept on request",
+			cmd:          copyCmd{configPreserve: preserveList{"volatile.base_image"}, unsetKeys: unsetList{"user.*"}, preserveTimestamps: true},
+			source:       source,
+			dest:         copyDestination{Remote: "remote"},
+			keepVolatile: false,
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config: map[string]string{
+					"limits.cpu":           "2",
+					"volatile.base_image":  "abcd",
+					"volatile.eth0.hwaddr": "00:16:3e:00:00:01",
+				},
+				Devices:   map[string]map[string]string{},
+				Profiles:  []string{"default"},
+				Ephemeral: true,
+				CreatedAt: time.Unix(1000, 0),
+				Volatile:  []string{"volatile.base_image"},
+			},
+		},
+		{
+			name:         "keep volatile keeps them all",
+			cmd:          copyCmd{rootfsOnly: true},
+			source:       source,
+			dest:         copyDestination{Remote: "remote"},
+			keepVolatile: true,
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config: map[string]string{
+					"volatile.base_image":  "abcd",
+					"volatile.eth0.hwaddr": "00:16:3e:00:00:01",
+				},
+				Devices:   map[string]map[string]string{},
+				Profiles:  []string{"default"},
+				Ephemeral: true,
+				Volatile:  []string{"volatile.base_image", "volatile.eth0.hwaddr"},
+			},
+		},
+		{
+			name: "the expiry of the source isn't inherited",
+			source: copySource{
+				Remote:   "local",
+				Config:   map[string]string{"expiry": "2100-01-01T00:00:00Z", "user.foo": "bar"},
+				Profiles: []string{},
+			},
+			dest: copyDestination{Remote: "remote"},
+			expected: copyPlan{
+				Config:   map[string]string{"user.foo": "bar"},
+				Devices:  map[string]map[string]string{},
+				Profiles: []string{},
+			},
+		},
+		{
+			name:   "--config wins over --instance-type",
+			cmd:    copyCmd{instanceConfig: map[string]string{"limits.cpu": "1"}, confArgs: configList{"limits.cpu=4"}},
+			source: source,
+			dest:   copyDestination{Remote: "remote"},
+			expected: copyPlan{
+				Architecture: "x86_64",
+				Config: map[string]string{
+					"limits.cpu":           "4",
+					"user.foo":             "bar",
+					"volatile.base_image":  "abcd",
+					"volatile.eth0.hwaddr": "00:16:3e:00:00:01",
+				},
+				Devices:   map[string]map[string]string{},
+				Profiles:  []string{"default"},
+				Ephemeral: true,
+				Warnings:  []string{"Using limits.cpu from --config instead of the one from --instance-type"},
+			},
+		},
+		{
+			name: "overriding a profile device keeps its other keys",
+			cmd:  copyCmd{deviceArgs: deviceList{"eth0,parent=br1", "tmp,path=/tmp"}},
+			source: copySource{
+				Remote: "local",
+				Config: map[string]string{},
+				Expanded: map[string]map[string]string{
+					"eth0": {"type": "nic", "nictype": "bridged", "parent": "lxdbr0"},
+				},
+				Devices:  map[string]map[string]string{},
+				Profiles: []string{"default"},
+			},
+			dest: copyDestination{Remote: "remote"},
+			expected: copyPlan{
+				Config: map[string]string{},
+				Devices: map[string]map[string]string{
+					"eth0": {"type": "nic", "nictype": "bridged", "parent": "br1"},
+					"tmp":  {"path": "/tmp"},
+				},
+				Profiles: []string{"default"},
+			},
+		},
+		{
+			name:     "stateful copies need a migration",
+			cmd:      copyCmd{stateful: true},
+			source:   running,
+			dest:     copyDestination{Remote: "local"},
+			stateful: true,
+			err:      true,
+		},
+		{
+			name:     "stateful copies need a running source",
+			cmd:      copyCmd{stateful: true},
+			source:   source,
+			dest:     copyDestination{Remote: "remote"},
+			stateful: true,
+			err:      true,
+		},
+		{
+			name:   "snapshots can't be verified",
+			cmd:    copyCmd{verify: true},
+			source: snapshot,
+			dest:   copyDestination{Remote: "remote"},
+			err:    true,
+		},
+	}
+
+	for _, test := range tests {
+		plan, err := test.cmd.computeCopyPlan(test.source, test.dest, test.ephemeral, test.stateful, false, test.keepVolatile)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.name, plan)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(plan, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, plan)
+		}
+	}
+
+	// The source is left alone
+	if source.Config["user.foo"] != "bar" || len(source.Profiles) != 1 {
+		t.Errorf("the source was modified: %+v", source)
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	source := map[string]string{
+		"limits.cpu":           "2",
+		"user.foo":             "bar",
+		"user.old":             "true",
+		"volatile.eth0.hwaddr": "00:16:3e:00:00:01",
+	}
+
+	result := map[string]string{
+		"limits.cpu":       "4",
+		"user.foo":         "bar",
+		"limits.memory":    "1GB",
+		"security.nesting": "true",
+	}
+
+	set, removed := configOverrides(source, result)
+
+	expectedSet := map[string]string{"limits.cpu": "4", "limits.memory": "1GB", "security.nesting": "true"}
+	if !reflect.DeepEqual(set, expectedSet) {
+		t.Errorf("expected %v to be set, got %v", expectedSet, set)
+	}
+
+	expectedRemoved := []string{"user.old"}
+	if !reflect.DeepEqual(removed, expectedRemoved) {
+		t.Errorf("expected %v to be removed, got %v", expectedRemoved, removed)
+	}
+}
+
+func TestConfirmReplace(t *testing.T) {
+	tests := []struct {
+		input     string
+		confirmed bool
+	}{
+		{"yes\n", true},
+		{"YES\n", true},
+		{"no\n", false},
+		{"y\n", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		out := bytes.Buffer{}
+		err := confirmReplace(strings.NewReader(test.input), &out, "c1")
+		if (err == nil) != test.confirmed {
+			t.Errorf("%q: expected confirmed %v, got error %v", test.input, test.confirmed, err)
+		}
+
+		if !strings.Contains(out.String(), "'c1'") {
+			t.Errorf("%q: the prompt doesn't name the container: %s", test.input, out.String())
+		}
+	}
+}
+
+func TestSameContainer(t *testing.T) {
+	tests := []struct {
+		sourceName    string
+		sourceProject string
+		destName      string
+		destProject   string
+		same          bool
+	}{
+		{"c1", "", "c1", "", true},
+		{"c1", "", "c2", "", false},
+		{"c1/snap0", "", "c1", "", true},
+		{"c1", "", "", "", false},
+		{"c1", "", "c1", "default", true},
+		{"c1", "foo", "c1", "", false},
+		{"c1", "foo", "c1", "foo", true},
+	}
+
+	for _, test := range tests {
+		same := sameContainer(test.sourceName, test.sourceProject, test.destName, test.destProject)
+		if same != test.same {
+			t.Errorf("%s (%q) to %s (%q): expected %v, got %v", test.sourceName, test.sourceProject, test.destName, test.destProject, test.same, same)
+		}
+	}
+}
+
+func TestNextFreeName(t *testing.T) {
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case failing:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `{"type": "error", "error": "database is locked", "error_code": 500}`)
+		case r.URL.Path == "/1.0/containers/c1-1":
+			fmt.Fprintf(w, `{"type": "sync", "status": "Success", "status_code": 200, "metadata": {"name": "c1-1"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"type": "error", "error": "not found", "error_code": 404}`)
+		}
+	}))
+	defer server.Close()
+
+	d := &lxd.Client{Name: "remote", BaseURL: server.URL, Remote: &lxd.RemoteConfig{}}
+
+	name, index, err := nextFreeName(d, "c1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "c1-2" || index != 2 {
+		t.Errorf("expected c1-2, got %s (%d)", name, index)
+	}
+
+	// A name is only free when the server says so
+	failing = true
+	_, _, err = nextFreeName(d, "c1", 1)
+	if err == nil {
+		t.Errorf("a server error was taken for a free name")
+	}
+}
+
+func TestNameCollision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{"type": "error", "error": "already exists", "error_code": 409}`)
+	}))
+	defer server.Close()
+
+	d := &lxd.Client{Name: "remote", BaseURL: server.URL, Remote: &lxd.RemoteConfig{}}
+
+	_, err := d.Rename("c1", "c2")
+	if !nameCollision(err) {
+		t.Errorf("expected a conflict to be a name collision, got: %v", err)
+	}
+
+	// Only the status of the response counts, not the text of the error
+	if nameCollision(fmt.Errorf("Snapshot 'c1/snap0' already exists")) {
+		t.Errorf("expected an error mentioning an existing snapshot not to be a name collision")
+	}
+}
@@ -35,6 +35,8 @@ func (f *configList) Set(value string) error {
 		return fmt.Errorf(i18n.G("Invalid configuration key"))
 	}
 
+	*f = append(*f, value)
+
 	if configMap == nil {
 		configMap = map[string]string{}
 	}
@@ -231,12 +233,12 @@ func (c *initCmd) run(config *lxd.Config, args []string) error {
 	}
 	op, err := resp.MetadataAsOperation()
 	if err != nil {
-		return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
+		return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+": %s (metadata: %s)", err, rawMetadata(resp))
 	}
 
 	containers, ok := op.Resources["containers"]
 	if !ok || len(containers) == 0 {
-		return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
+		return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+" (metadata: %s)", rawMetadata(resp))
 	}
 
 	if len(containers) == 1 && name == "" {
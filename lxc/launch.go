@@ -112,13 +112,13 @@ func (c *launchCmd) run(config *lxd.Config, args []string) error {
 		op, err := resp.MetadataAsOperation()
 		if err != nil {
 			progress.Done("")
-			return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
+			return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+": %s (metadata: %s)", err, rawMetadata(resp))
 		}
 
 		containers, ok := op.Resources["containers"]
 		if !ok || len(containers) == 0 {
 			progress.Done("")
-			return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server"))
+			return fmt.Errorf(i18n.G("didn't get any affected image, container or snapshot from server")+" (metadata: %s)", rawMetadata(resp))
 		}
 
 		var restVersion string
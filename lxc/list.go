@@ -478,9 +478,10 @@ func (c *listCmd) parseColumns() ([]column, error) {
 			return nil, fmt.Errorf("Empty column entry (redundant, leading or trailing command) in '%s'", c.columnsRaw)
 		}
 
-		// Config keys always contain a period, parse anything without a
-		// period as a series of shorthand runes.
-		if !strings.Contains(columnEntry, ".") {
+		// Config keys contain a period but for a few known ones, parse
+		// anything else as a series of shorthand runes.
+		_, known := shared.KnownContainerConfigKeys[strings.SplitN(columnEntry, ":", 2)[0]]
+		if !strings.Contains(columnEntry, ".") && !known {
 			for _, columnRune := range columnEntry {
 				if column, ok := columnsShorthandMap[columnRune]; ok {
 					columns = append(columns, column)
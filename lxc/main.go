@@ -25,7 +25,14 @@ func main() {
 	if err := run(); err != nil {
 		msg := fmt.Sprintf(i18n.G("error: %v"), err)
 
-		lxdErr := lxd.GetLocalLXDErr(err)
+		// The exit code aside, the error is handled as any other
+		cause := err
+		exitErr, ok := err.(exitError)
+		if ok {
+			cause = exitErr.err
+		}
+
+		lxdErr := lxd.GetLocalLXDErr(cause)
 		switch lxdErr {
 		case syscall.ENOENT:
 			msg = i18n.G("LXD socket not found; is LXD installed and running?")
@@ -36,10 +43,26 @@ func main() {
 		}
 
 		fmt.Fprintln(os.Stderr, fmt.Sprintf("%s", msg))
+
+		if ok {
+			os.Exit(exitErr.code)
+		}
+
 		os.Exit(1)
 	}
 }
 
+// exitError is an error for which the process exits with a specific code
+// instead of 1
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
 func run() error {
 	verbose := gnuflag.Bool("verbose", false, i18n.G("Enable verbose mode"))
 	debug := gnuflag.Bool("debug", false, i18n.G("Enable debug mode"))
@@ -204,6 +227,7 @@ var commands = map[string]command{
 	},
 	"profile": &profileCmd{},
 	"publish": &publishCmd{},
+	"rebase":  &rebaseCmd{},
 	"remote":  &remoteCmd{},
 	"restart": &actionCmd{
 		action:      shared.Restart,
@@ -9,6 +9,7 @@ import (
 
 type moveCmd struct {
 	containerOnly bool
+	stateful      bool
 }
 
 func (c *moveCmd) showByDefault() bool {
@@ -17,10 +18,13 @@ func (c *moveCmd) showByDefault() bool {
 
 func (c *moveCmd) usage() string {
 	return i18n.G(
-		`Usage: lxc move [<remote>:]<container>[/<snapshot>] [<remote>:][<container>[/<snapshot>]] [--container-only]
+		`Usage: lxc move [<remote>:]<container>[/<snapshot>] [<remote>:][<container>[/<snapshot>]] [--container-only] [--stateful=false]
 
 Move containers within or in between LXD instances.
 
+Running containers are moved along with their runtime state unless
+--stateful=false is passed.
+
 lxc move [<remote>:]<source container> [<remote>:][<destination container>] [--container-only]
     Move a container between two hosts, renaming it if destination name differs.
 
@@ -33,6 +37,7 @@ lxc move <container>/<old snapshot name> <container>/<new snapshot name>
 
 func (c *moveCmd) flags() {
 	gnuflag.BoolVar(&c.containerOnly, "container-only", false, i18n.G("Move the container without its snapshots"))
+	gnuflag.BoolVar(&c.stateful, "stateful", true, i18n.G("Move a running container along with its runtime state"))
 }
 
 func (c *moveCmd) run(config *lxd.Config, args []string) error {
@@ -62,11 +67,12 @@ func (c *moveCmd) run(config *lxd.Config, args []string) error {
 		return source.WaitForSuccess(rename.Operation)
 	}
 
-	cpy := copyCmd{}
+	cpy := copyCmd{wait: true}
 
 	// A move is just a copy followed by a delete; however, we want to
 	// keep the volatile entries around since we are moving the container.
-	err := cpy.copyContainer(config, args[0], args[1], true, -1, true, c.containerOnly)
+	// The source is only deleted once the copy went through.
+	err := cpy.copyContainer(config, args[0], args[1], true, nil, c.stateful, c.containerOnly)
 	if err != nil {
 		return err
 	}
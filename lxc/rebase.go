@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lxc/lxd"
+	"github.com/lxc/lxd/shared/gnuflag"
+	"github.com/lxc/lxd/shared/i18n"
+)
+
+type rebaseCmd struct {
+	backup bool
+	yes    bool
+}
+
+func (c *rebaseCmd) showByDefault() bool {
+	return false
+}
+
+func (c *rebaseCmd) usage() string {
+	return i18n.G(
+		`Usage: lxc rebase [<remote>:]<container> [<remote>:]<image> [--backup] [--yes|-y]
+
+Recreate containers from a different image, keeping their configuration.
+
+The container must be stopped. It's moved aside and a new container is
+created from the image with its config, devices and profiles. The existing
+container is put back if that fails.
+
+The existing container and its snapshots are deleted once replaced, which
+is confirmed first. --yes skips the confirmation, it's required when not
+running in a terminal. --backup keeps the existing container under a
+<container>-backup-<date> name instead.
+
+*Examples*
+lxc rebase c1 ubuntu:16.04
+    Recreate c1 from the latest Ubuntu 16.04 image.`)
+}
+
+func (c *rebaseCmd) flags() {
+	gnuflag.BoolVar(&c.backup, "backup", false, i18n.G("Keep the existing container under another name"))
+	gnuflag.BoolVar(&c.yes, "yes", false, i18n.G("Don't ask for confirmation before replacing the container"))
+	gnuflag.BoolVar(&c.yes, "y", false, i18n.G("Don't ask for confirmation before replacing the container"))
+}
+
+func (c *rebaseCmd) run(config *lxd.Config, args []string) error {
+	if len(args) != 2 {
+		return errArgs
+	}
+
+	remote, name := config.ParseRemoteAndContainer(args[0])
+	iremote, image := config.ParseRemoteAndContainer(args[1])
+
+	d, err := lxd.NewClient(config, remote)
+	if err != nil {
+		return err
+	}
+
+	ct, err := d.ContainerInfo(name)
+	if err != nil {
+		return err
+	}
+
+	if ct.IsActive() {
+		return fmt.Errorf(i18n.G("The container is currently running, stop it first"))
+	}
+
+	// The volatile keys belong to the old container, the new one gets
+	// its own.
+	containerConfig := map[string]string{}
+	for k, v := range ct.Config {
+		if strings.HasPrefix(k, "volatile") {
+			continue
+		}
+
+		containerConfig[k] = v
+	}
+
+	// Move the existing container out of the way the same way copies
+	// replace containers, it's put back if the new one can't be created.
+	replacer := copyCmd{backup: c.backup, yes: c.yes}
+	backupName := replaceBackupName(name, time.Now())
+	replaced, err := replacer.moveAside(d, name, backupName)
+	if err != nil {
+		return err
+	}
+
+	init := initCmd{}
+	iremote, image = init.guessImage(config, d, remote, iremote, image)
+
+	resp, err := d.Init(name, iremote, image, &ct.Profiles, containerConfig, ct.Devices, ct.Ephemeral)
+	if err == nil {
+		progress := ProgressRenderer{}
+		init.initProgressTracker(d, &progress, resp.Operation)
+
+		err = d.WaitForSuccess(resp.Operation)
+		progress.Done("")
+	}
+
+	if err != nil {
+		replacer.deleteFailedCopy(d, name)
+		if replaced != nil {
+			replacer.restoreReplaced(d, replaced, backupName, name)
+		}
+
+		return err
+	}
+
+	if c.backup {
+		fmt.Printf(i18n.G("The previous container was kept as '%s'")+"\n", backupName)
+		return nil
+	}
+
+	replacer.deleteReplaced(d, backupName)
+	return nil
+}
@@ -194,3 +194,20 @@ func summaryLine(usage string) string {
 
 	return i18n.G("Missing summary.")
 }
+
+// rawMetadata returns the metadata of a response as sent by the server, cut
+// short when it's too long to be part of an error
+func rawMetadata(resp *api.Response) string {
+	const max = 512
+
+	metadata := strings.TrimSpace(string(resp.Metadata))
+	if metadata == "" {
+		return "none"
+	}
+
+	if len(metadata) > max {
+		return metadata[:max] + "..."
+	}
+
+	return metadata
+}
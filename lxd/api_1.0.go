@@ -109,6 +109,20 @@ func api10Get(d *Daemon, r *http.Request) Response {
 			"entity_description",
 			"image_force_refresh",
 			"storage_lvm_lv_resizing",
+			"container_incremental_copy",
+			"container_copy_timestamps",
+			"container_migration_bwlimit",
+			"container_migration_resume",
+			"container_copy_allow_inconsistent",
+			"operation_fs_progress_bytes",
+			"container_migration_compression",
+			"container_push_target",
+			"container_migration_protocol",
+			"container_migration_snapshot_list",
+			"container_migration_excludes",
+			"container_expiry",
+			"storage_api_volume_rsync",
+			"container_migration_refresh",
 		},
 		APIStatus:  "stable",
 		APIVersion: version.APIVersion,
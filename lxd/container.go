@@ -200,6 +200,25 @@ func containerValidDeviceConfigKey(t, k string) bool {
 	}
 }
 
+// containerValidExpiry makes sure a newly set expiry isn't already past, the
+// container would be deleted right away
+func containerValidExpiry(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("Invalid expiry date: %s", value)
+	}
+
+	if !expiry.After(time.Now()) {
+		return fmt.Errorf("The expiry date %s is in the past", value)
+	}
+
+	return nil
+}
+
 func containerValidConfig(d *Daemon, config map[string]string, profile bool, expanded bool) error {
 	if config == nil {
 		return nil
@@ -214,6 +233,10 @@ func containerValidConfig(d *Daemon, config map[string]string, profile bool, exp
 			return fmt.Errorf("Image keys can only be set on containers.")
 		}
 
+		if profile && k == "expiry" {
+			return fmt.Errorf("Expiry can only be set on containers.")
+		}
+
 		err := containerValidConfigKey(d, k, v)
 		if err != nil {
 			return err
@@ -768,6 +791,14 @@ func containerCreateInternal(d *Daemon, args containerArgs) (container, error) {
 		return nil, err
 	}
 
+	// Snapshots keep the expiry of their container as it was
+	if args.Ctype == cTypeRegular {
+		err = containerValidExpiry(args.Config["expiry"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Validate container devices
 	err = containerValidDevices(d, args.Devices, false, false)
 	if err != nil {
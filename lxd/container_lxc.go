@@ -3079,6 +3079,13 @@ func (c *containerLXC) Update(args containerArgs, userRequested bool) error {
 		return err
 	}
 
+	if args.Config["expiry"] != c.localConfig["expiry"] {
+		err = containerValidExpiry(args.Config["expiry"])
+		if err != nil {
+			return err
+		}
+	}
+
 	// Validate the new devices
 	err = containerValidDevices(c.daemon, args.Devices, false, false)
 	if err != nil {
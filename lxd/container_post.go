@@ -47,7 +47,7 @@ func containerPost(d *Daemon, r *http.Request) Response {
 	}
 
 	if req.Migration {
-		ws, err := NewMigrationSource(c, stateful, req.ContainerOnly)
+		ws, err := NewMigrationSource(c, stateful, req.ContainerOnly, req.Bwlimit, req.AllowInconsistent, req.Compression, req.Protocol, req.Snapshots, req.Excludes, req.Refresh)
 		if err != nil {
 			return InternalError(err)
 		}
@@ -55,6 +55,25 @@ func containerPost(d *Daemon, r *http.Request) Response {
 		resources := map[string][]string{}
 		resources["containers"] = []string{name}
 
+		// In push mode the source connects to the target on its own
+		if req.Target != nil {
+			run := func(op *operation) error {
+				err := ws.ConnectTarget(*req.Target)
+				if err != nil {
+					return err
+				}
+
+				return ws.Do(op)
+			}
+
+			op, err := operationCreate(operationClassTask, resources, nil, run, nil, nil)
+			if err != nil {
+				return InternalError(err)
+			}
+
+			return OperationResponse(op)
+		}
+
 		op, err := operationCreate(operationClassWebsocket, resources, ws.Metadata(), ws.Do, nil, ws.Connect)
 		if err != nil {
 			return InternalError(err)
@@ -203,7 +203,11 @@ func snapshotPost(d *Daemon, r *http.Request, sc container, containerName string
 
 	migration, err := raw.GetBool("migration")
 	if err == nil && migration {
-		ws, err := NewMigrationSource(sc, false, true)
+		bwlimit, _ := raw.GetString("bwlimit")
+		compression, _ := raw.GetString("compression")
+		protocol, _ := raw.GetString("protocol")
+
+		ws, err := NewMigrationSource(sc, false, true, bwlimit, false, compression, protocol, nil, nil, false)
 		if err != nil {
 			return SmartError(err)
 		}
@@ -180,6 +180,50 @@ func containersShutdown(d *Daemon) error {
 	return nil
 }
 
+// containersPruneExpired stops and deletes the containers whose expiry date
+// has passed
+func containersPruneExpired(d *Daemon) {
+	results, err := dbContainersList(d.db, cTypeRegular)
+	if err != nil {
+		logger.Error("Unable to retrieve the list of containers to expire", log.Ctx{"err": err})
+		return
+	}
+
+	now := time.Now()
+	for _, name := range results {
+		c, err := containerLoadByName(d, name)
+		if err != nil {
+			continue
+		}
+
+		// Profiles can't set it, only the container itself
+		value := c.LocalConfig()["expiry"]
+		if value == "" {
+			continue
+		}
+
+		expiry, err := time.Parse(time.RFC3339, value)
+		if err != nil || expiry.After(now) {
+			continue
+		}
+
+		logger.Info("Deleting expired container", log.Ctx{"container": name, "expiry": value})
+
+		if c.IsRunning() {
+			err := c.Stop(false)
+			if err != nil {
+				logger.Error("Failed to stop expired container", log.Ctx{"container": name, "err": err})
+				continue
+			}
+		}
+
+		err = c.Delete()
+		if err != nil {
+			logger.Error("Failed to delete expired container", log.Ctx{"container": name, "err": err})
+		}
+	}
+}
+
 func containerDeleteSnapshots(d *Daemon, cname string) error {
 	logger.Debug("containerDeleteSnapshots",
 		log.Ctx{"container": cname})
@@ -181,6 +181,8 @@ func createFromMigration(d *Daemon, req *api.ContainersPost) Response {
 		Architecture: architecture,
 		BaseImage:    req.Source.BaseImage,
 		Config:       req.Config,
+		CreationDate: req.CreatedAt,
+		LastUsedDate: req.LastUsedAt,
 		Ctype:        cTypeRegular,
 		Devices:      req.Devices,
 		Ephemeral:    req.Ephemeral,
@@ -272,58 +274,81 @@ func createFromMigration(d *Daemon, req *api.ContainersPost) Response {
 		args.Devices[localRootDiskDeviceKey]["pool"] = storagePool
 	}
 
-	/* Only create a container from an image if we're going to
-	 * rsync over the top of it. In the case of a better file
-	 * transfer mechanism, let's just use that.
-	 *
-	 * TODO: we could invent some negotiation here, where if the
-	 * source and sink both have the same image, we can clone from
-	 * it, but we have to know before sending the snapshot that
-	 * we're sending the whole thing or just a delta from the
-	 * image, so one extra negotiation round trip is needed. An
-	 * alternative is to move actual container object to a later
-	 * point and just negotiate it over the migration control
-	 * socket. Anyway, it'll happen later :)
-	 */
-	_, _, err = dbImageGet(d.db, req.Source.BaseImage, false, true)
-	if err != nil {
-		c, err = containerCreateAsEmpty(d, args)
-		if err != nil {
-			return InternalError(err)
-		}
-	} else {
-		// Retrieve the future storage pool
-		cM, err := containerLXCLoad(d, args)
-		if err != nil {
-			return InternalError(err)
-		}
+	// When refreshing, sync over the existing container instead of
+	// creating a new one.
+	refresh := false
+	if req.Source.Refresh {
+		c, err = containerLoadByName(d, req.Name)
+		if err == nil {
+			if c.IsRunning() {
+				return BadRequest(fmt.Errorf("Cannot refresh a running container"))
+			}
 
-		_, rootDiskDevice, err := containerGetRootDiskDevice(cM.ExpandedDevices())
-		if err != nil {
-			return InternalError(err)
+			refresh = true
 		}
+	}
 
-		if rootDiskDevice["pool"] == "" {
-			return BadRequest(fmt.Errorf("The container's root device is missing the pool property."))
+	// Never delete a container we didn't create ourselves.
+	deleteOnFailure := func() {
+		if !refresh {
+			c.Delete()
 		}
+	}
 
-		storagePool = rootDiskDevice["pool"]
-
-		ps, err := storagePoolInit(d, storagePool)
+	if !refresh {
+		/* Only create a container from an image if we're going to
+		 * rsync over the top of it. In the case of a better file
+		 * transfer mechanism, let's just use that.
+		 *
+		 * TODO: we could invent some negotiation here, where if the
+		 * source and sink both have the same image, we can clone from
+		 * it, but we have to know before sending the snapshot that
+		 * we're sending the whole thing or just a delta from the
+		 * image, so one extra negotiation round trip is needed. An
+		 * alternative is to move actual container object to a later
+		 * point and just negotiate it over the migration control
+		 * socket. Anyway, it'll happen later :)
+		 */
+		_, _, err = dbImageGet(d.db, req.Source.BaseImage, false, true)
 		if err != nil {
-			return InternalError(err)
-		}
-
-		if ps.MigrationType() == MigrationFSType_RSYNC {
-			c, err = containerCreateFromImage(d, args, req.Source.BaseImage)
+			c, err = containerCreateAsEmpty(d, args)
 			if err != nil {
 				return InternalError(err)
 			}
 		} else {
-			c, err = containerCreateAsEmpty(d, args)
+			// Retrieve the future storage pool
+			cM, err := containerLXCLoad(d, args)
+			if err != nil {
+				return InternalError(err)
+			}
+
+			_, rootDiskDevice, err := containerGetRootDiskDevice(cM.ExpandedDevices())
 			if err != nil {
 				return InternalError(err)
 			}
+
+			if rootDiskDevice["pool"] == "" {
+				return BadRequest(fmt.Errorf("The container's root device is missing the pool property."))
+			}
+
+			storagePool = rootDiskDevice["pool"]
+
+			ps, err := storagePoolInit(d, storagePool)
+			if err != nil {
+				return InternalError(err)
+			}
+
+			if ps.MigrationType() == MigrationFSType_RSYNC {
+				c, err = containerCreateFromImage(d, args, req.Source.BaseImage)
+				if err != nil {
+					return InternalError(err)
+				}
+			} else {
+				c, err = containerCreateAsEmpty(d, args)
+				if err != nil {
+					return InternalError(err)
+				}
+			}
 		}
 	}
 
@@ -331,20 +356,20 @@ func createFromMigration(d *Daemon, req *api.ContainersPost) Response {
 	if req.Source.Certificate != "" {
 		certBlock, _ := pem.Decode([]byte(req.Source.Certificate))
 		if certBlock == nil {
-			c.Delete()
+			deleteOnFailure()
 			return InternalError(fmt.Errorf("Invalid certificate"))
 		}
 
 		cert, err = x509.ParseCertificate(certBlock.Bytes)
 		if err != nil {
-			c.Delete()
+			deleteOnFailure()
 			return InternalError(err)
 		}
 	}
 
 	config, err := shared.GetTLSConfig("", "", "", cert)
 	if err != nil {
-		c.Delete()
+		deleteOnFailure()
 		return InternalError(err)
 	}
 
@@ -363,11 +388,13 @@ func createFromMigration(d *Daemon, req *api.ContainersPost) Response {
 		Push:          push,
 		Live:          req.Source.Live,
 		ContainerOnly: req.Source.ContainerOnly,
+		Refresh:       refresh,
+		Compression:   req.Source.Compression,
 	}
 
 	sink, err := NewMigrationSink(&migrationArgs)
 	if err != nil {
-		c.Delete()
+		deleteOnFailure()
 		return InternalError(err)
 	}
 
@@ -376,13 +403,18 @@ func createFromMigration(d *Daemon, req *api.ContainersPost) Response {
 		err = sink.Do(op)
 		if err != nil {
 			logger.Error("Error during migration sink", log.Ctx{"err": err})
-			c.Delete()
+
+			// Keep what was transferred so far around so that
+			// refreshing again resumes from there.
+			if !req.Source.Refresh {
+				deleteOnFailure()
+			}
 			return fmt.Errorf("Error transferring container data: %s", err)
 		}
 
 		err = c.TemplateApply("copy")
 		if err != nil {
-			c.Delete()
+			deleteOnFailure()
 			return err
 		}
 
@@ -432,6 +464,11 @@ func createFromCopy(d *Daemon, req *api.ContainersPost) Response {
 			continue
 		}
 
+		// The copy only expires when asked to
+		if key == "expiry" {
+			continue
+		}
+
 		_, exists := req.Config[key]
 		if exists {
 			continue
@@ -465,6 +502,8 @@ func createFromCopy(d *Daemon, req *api.ContainersPost) Response {
 		Architecture: source.Architecture(),
 		BaseImage:    req.Source.BaseImage,
 		Config:       req.Config,
+		CreationDate: req.CreatedAt,
+		LastUsedDate: req.LastUsedAt,
 		Ctype:        cTypeRegular,
 		Devices:      req.Devices,
 		Ephemeral:    req.Ephemeral,
@@ -472,8 +511,11 @@ func createFromCopy(d *Daemon, req *api.ContainersPost) Response {
 		Profiles:     req.Profiles,
 	}
 
+	// A snapshot has no snapshots of its own to copy
+	containerOnly := req.Source.ContainerOnly || source.IsSnapshot()
+
 	run := func(op *operation) error {
-		_, err := containerCreateAsCopy(d, args, source, req.Source.ContainerOnly)
+		_, err := containerCreateAsCopy(d, args, source, containerOnly)
 		if err != nil {
 			return err
 		}
@@ -538,6 +580,15 @@ func containersPost(d *Daemon, r *http.Request) Response {
 		return BadRequest(fmt.Errorf("Invalid container name: '%s' is reserved for snapshots", shared.SnapshotDelimiter))
 	}
 
+	// Check that the name isn't already in use, unless refreshing the
+	// existing container
+	if req.Source.Type != "migration" || !req.Source.Refresh {
+		id, _ := dbContainerId(d.db, req.Name)
+		if id > 0 {
+			return Conflict
+		}
+	}
+
 	switch req.Source.Type {
 	case "image":
 		return createFromImage(d, &req)
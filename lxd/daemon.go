@@ -1110,6 +1110,15 @@ func (d *Daemon) Ready() error {
 	/* Restore containers */
 	containersRestart(d)
 
+	/* Delete expired containers */
+	go func() {
+		t := time.NewTicker(time.Minute)
+		for {
+			containersPruneExpired(d)
+			<-t.C
+		}
+	}()
+
 	/* Re-balance in case things changed while LXD was down */
 	deviceTaskBalance(d)
 
@@ -135,8 +135,13 @@ func dbContainerCreate(db *sql.DB, args containerArgs) (int, error) {
 		statefulInt = 1
 	}
 
-	args.CreationDate = time.Now().UTC()
-	args.LastUsedDate = time.Unix(0, 0).UTC()
+	if args.CreationDate.IsZero() {
+		args.CreationDate = time.Now().UTC()
+	}
+
+	if args.LastUsedDate.IsZero() {
+		args.LastUsedDate = time.Unix(0, 0).UTC()
+	}
 
 	str := fmt.Sprintf("INSERT INTO containers (name, architecture, type, ephemeral, creation_date, last_use_date, stateful) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	stmt, err := tx.Prepare(str)
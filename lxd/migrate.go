@@ -6,6 +6,8 @@
 package main
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -21,6 +23,7 @@ import (
 	"gopkg.in/lxc/go-lxc.v2"
 
 	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
 	"github.com/lxc/lxd/shared/logger"
 )
 
@@ -151,14 +154,71 @@ func (c *migrationFields) controlChannel() <-chan MigrationControl {
 type migrationSourceWs struct {
 	migrationFields
 
-	allConnected chan bool
+	allConnected      chan bool
+	bwlimit           string
+	allowInconsistent bool
+	compression       string
+	protocol          string
+	snapshots         []string
+	excludes          []string
+	refresh           bool
 }
 
-func NewMigrationSource(c container, stateful bool, containerOnly bool) (*migrationSourceWs, error) {
-	ret := migrationSourceWs{migrationFields{container: c}, make(chan bool, 1)}
+func NewMigrationSource(c container, stateful bool, containerOnly bool, bwlimit string, allowInconsistent bool, compression string, protocol string, snapshots []string, excludes []string, refresh bool) (*migrationSourceWs, error) {
+	ret := migrationSourceWs{migrationFields{container: c}, make(chan bool, 1), bwlimit, allowInconsistent, compression, protocol, snapshots, rootfsExcludes(excludes), refresh}
 	ret.containerOnly = containerOnly
 
-	var err error
+	err := migrationValidCompression(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(excludes) > 0 && protocol != "" && protocol != "rsync" {
+		return nil, fmt.Errorf("Excluding paths requires the rsync protocol")
+	}
+
+	if len(snapshots) > 0 {
+		if containerOnly {
+			return nil, fmt.Errorf("Snapshots can't be listed for a container only migration")
+		}
+
+		if protocol != "" && protocol != "rsync" {
+			return nil, fmt.Errorf("Listing the snapshots requires the rsync protocol")
+		}
+
+		existing, err := c.Snapshots()
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{}
+		for _, snap := range existing {
+			names = append(names, shared.ExtractSnapshotName(snap.Name()))
+		}
+
+		missing := shared.NewStringSet(snapshots).Difference(shared.NewStringSet(names))
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("Snapshots not found: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	if protocol != "" {
+		fsType, err := migrationProtocolType(protocol)
+		if err != nil {
+			return nil, err
+		}
+
+		if fsType != MigrationFSType_RSYNC {
+			if fsType != c.Storage().MigrationType() {
+				return nil, fmt.Errorf("The storage of the container can't be transferred through %s", protocol)
+			}
+
+			if bwlimit != "" || compression != "" {
+				return nil, fmt.Errorf("A rate limit or stream compression requires the rsync protocol")
+			}
+		}
+	}
+
 	ret.controlSecret, err = shared.RandomCryptoString()
 	if err != nil {
 		return nil, err
@@ -185,6 +245,76 @@ func NewMigrationSource(c container, stateful bool, containerOnly bool) (*migrat
 	return &ret, nil
 }
 
+// rootfsExcludes turns the exclude patterns of a migration, whose absolute
+// paths are in the root filesystem of the container, into rsync ones for the
+// directory of the container
+func rootfsExcludes(excludes []string) []string {
+	patterns := []string{}
+	for _, exclude := range excludes {
+		if strings.HasPrefix(exclude, "/") {
+			exclude = "/rootfs" + exclude
+		}
+
+		patterns = append(patterns, exclude)
+	}
+
+	return patterns
+}
+
+// rsyncSource returns the rsync driver of the container, which only sends
+// the listed snapshots if any
+func (s *migrationSourceWs) rsyncSource() (MigrationStorageSourceDriver, error) {
+	driver, err := rsyncMigrationSource(s.container, s.containerOnly)
+	if err != nil || len(s.snapshots) == 0 {
+		return driver, err
+	}
+
+	rsyncDriver := driver.(rsyncStorageSourceDriver)
+	snapshots := []container{}
+	for _, snap := range rsyncDriver.snapshots {
+		if shared.StringInSlice(shared.ExtractSnapshotName(snap.Name()), s.snapshots) {
+			snapshots = append(snapshots, snap)
+		}
+	}
+	rsyncDriver.snapshots = snapshots
+
+	return rsyncDriver, nil
+}
+
+// refreshSnapshots returns the snapshots missing from the destination of a
+// refresh
+func refreshSnapshots(snapshots []container, existing []string) []container {
+	missing := []container{}
+	for _, snap := range snapshots {
+		if !shared.StringInSlice(shared.ExtractSnapshotName(snap.Name()), existing) {
+			missing = append(missing, snap)
+		}
+	}
+
+	return missing
+}
+
+// migrationProtocolType returns the filesystem transfer type of a protocol
+// name, e.g. "rsync" or "zfs"
+func migrationProtocolType(protocol string) (MigrationFSType, error) {
+	value, ok := MigrationFSType_value[strings.ToUpper(protocol)]
+	if !ok {
+		return MigrationFSType_RSYNC, fmt.Errorf("Unknown migration protocol: %s", protocol)
+	}
+
+	return MigrationFSType(value), nil
+}
+
+// migrationValidCompression checks that the stream compression of a migration
+// is one rsync is set up for
+func migrationValidCompression(compression string) error {
+	if !shared.StringInSlice(compression, []string{"", "none", "lz4", "zstd", "gzip"}) {
+		return fmt.Errorf("Unknown migration compression: %s", compression)
+	}
+
+	return nil
+}
+
 func (s *migrationSourceWs) Metadata() interface{} {
 	secrets := shared.Jmap{
 		"control": s.controlSecret,
@@ -234,6 +364,71 @@ func (s *migrationSourceWs) Connect(op *operation, r *http.Request, w http.Respo
 	return nil
 }
 
+// ConnectTarget connects the source to the websockets of a migration sink
+// operation in push mode, instead of waiting for the sink to connect.
+func (s *migrationSourceWs) ConnectTarget(target api.ContainerPostTarget) error {
+	var cert *x509.Certificate
+	if target.Certificate != "" {
+		certBlock, _ := pem.Decode([]byte(target.Certificate))
+		if certBlock == nil {
+			return fmt.Errorf("Invalid certificate")
+		}
+
+		var err error
+		cert, err = x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := shared.GetTLSConfig("", "", "", cert)
+	if err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig: config,
+		NetDial:         shared.RFC3493Dialer,
+	}
+
+	for name, secret := range target.Websockets {
+		var conn **websocket.Conn
+
+		switch name {
+		case "control":
+			conn = &s.controlConn
+		case "fs":
+			conn = &s.fsConn
+		case "criu":
+			conn = &s.criuConn
+		default:
+			return fmt.Errorf("Unknown secret provided: %s", name)
+		}
+
+		query := url.Values{"secret": []string{secret}}
+
+		// The URL is a https URL to the operation, mangle to be a wss URL to the secret
+		wsUrl := fmt.Sprintf("wss://%s/websocket?%s", strings.TrimPrefix(target.Operation, "https://"), query.Encode())
+
+		wsConn, _, err := dialer.Dial(wsUrl, http.Header{})
+		if err != nil {
+			s.disconnect()
+			return err
+		}
+
+		*conn = wsConn
+	}
+
+	if s.controlConn == nil || s.fsConn == nil || (s.live && s.criuConn == nil) {
+		s.disconnect()
+		return fmt.Errorf("Missing secrets for the migration target")
+	}
+
+	s.allConnected <- true
+
+	return nil
+}
+
 func writeActionScript(directory string, operation string, secret string) error {
 	script := fmt.Sprintf(`#!/bin/sh -e
 if [ "$CRTOOLS_SCRIPT_ACTION" = "post-dump" ]; then
@@ -333,6 +528,13 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 
 	driver, fsErr := s.container.Storage().MigrationSource(s.container, s.containerOnly)
 
+	// A rate limit, stream compression, a subset of the snapshots or
+	// excluded paths can only be handled when transferring through rsync
+	forceRsync := s.bwlimit != "" || s.compression != "" || s.protocol == "rsync" || len(s.snapshots) > 0 || len(s.excludes) > 0
+	if forceRsync {
+		driver, fsErr = s.rsyncSource()
+	}
+
 	snapshots := []*Snapshot{}
 	snapshotNames := []string{}
 	// Only send snapshots when requested.
@@ -349,6 +551,10 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 	// The protocol says we have to send a header no matter what, so let's
 	// do that, but then immediately send an error.
 	myType := s.container.Storage().MigrationType()
+	if forceRsync {
+		myType = MigrationFSType_RSYNC
+	}
+
 	header := MigrationHeader{
 		Fs:            &myType,
 		Criu:          criuType,
@@ -357,6 +563,11 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 		Snapshots:     snapshots,
 	}
 
+	// Let the destination know it can tell which snapshots it has
+	if s.refresh {
+		header.Refresh = proto.Bool(true)
+	}
+
 	err = s.send(&header)
 	if err != nil {
 		s.sendControl(err)
@@ -374,16 +585,22 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 		return err
 	}
 
-	bwlimit := ""
+	bwlimit := s.bwlimit
+	if *header.Fs != myType && s.protocol != "" {
+		err := fmt.Errorf("The destination can't receive through %s", s.protocol)
+		s.sendControl(err)
+		return err
+	}
+
 	if *header.Fs != myType {
 		myType = MigrationFSType_RSYNC
 		header.Fs = &myType
 
-		driver, _ = rsyncMigrationSource(s.container, s.containerOnly)
+		driver, _ = s.rsyncSource()
 
 		// Check if this storage pool has a rate limit set for rsync.
 		poolwritable := s.container.Storage().GetStoragePoolWritable()
-		if poolwritable.Config != nil {
+		if bwlimit == "" && poolwritable.Config != nil {
 			bwlimit = poolwritable.Config["rsync.bwlimit"]
 		}
 	}
@@ -401,6 +618,23 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 		return err
 	}
 
+	// Only rsync can tolerate files changing under it, the other drivers
+	// send from a snapshot anyway.
+	rsyncDriver, ok := driver.(rsyncStorageSourceDriver)
+	if ok {
+		rsyncDriver.allowInconsistent = s.allowInconsistent
+		rsyncDriver.compression = s.compression
+		rsyncDriver.excludes = s.excludes
+
+		// The destination of a refresh lists the snapshots it already
+		// has, those aren't sent again
+		if s.refresh {
+			rsyncDriver.snapshots = refreshSnapshots(rsyncDriver.snapshots, header.SnapshotNames)
+		}
+
+		driver = rsyncDriver
+	}
+
 	err = driver.SendWhileRunning(s.fsConn, migrateOp, bwlimit, s.containerOnly)
 	if err != nil {
 		return abort(err)
@@ -523,7 +757,7 @@ func (s *migrationSourceWs) Do(migrateOp *operation) error {
 		 * p.haul's protocol, it will make sense to do these in parallel.
 		 */
 		ctName, _, _ := containerGetParentAndSnapshotName(s.container.Name())
-		err = RsyncSend(ctName, shared.AddSlash(checkpointDir), s.criuConn, nil, bwlimit)
+		err = RsyncSend(ctName, shared.AddSlash(checkpointDir), s.criuConn, nil, bwlimit, false, "", nil)
 		if err != nil {
 			return abort(err)
 		}
@@ -570,6 +804,8 @@ type migrationSink struct {
 	dialer       websocket.Dialer
 	allConnected chan bool
 	push         bool
+	refresh      bool
+	compression  string
 }
 
 type MigrationSinkArgs struct {
@@ -580,23 +816,31 @@ type MigrationSinkArgs struct {
 	Push          bool
 	Live          bool
 	ContainerOnly bool
+	Refresh       bool
+	Compression   string
 }
 
 func NewMigrationSink(args *MigrationSinkArgs) (*migrationSink, error) {
 	sink := migrationSink{
-		src:    migrationFields{container: args.Container, containerOnly: args.ContainerOnly},
-		dest:   migrationFields{containerOnly: args.ContainerOnly},
-		url:    args.Url,
-		dialer: args.Dialer,
-		push:   args.Push,
+		src:         migrationFields{container: args.Container, containerOnly: args.ContainerOnly},
+		dest:        migrationFields{containerOnly: args.ContainerOnly},
+		url:         args.Url,
+		dialer:      args.Dialer,
+		push:        args.Push,
+		refresh:     args.Refresh,
+		compression: args.Compression,
 	}
 
 	if sink.push {
 		sink.allConnected = make(chan bool, 1)
 	}
 
+	err := migrationValidCompression(args.Compression)
+	if err != nil {
+		return nil, err
+	}
+
 	var ok bool
-	var err error
 	if sink.push {
 		sink.dest.controlSecret, err = shared.RandomCryptoString()
 		if err != nil {
@@ -777,13 +1021,38 @@ func (c *migrationSink) Do(migrateOp *operation) error {
 	}
 
 	// If the storage type the source has doesn't match what we have, then
-	// we have to use rsync.
-	if *header.Fs != *resp.Fs {
+	// we have to use rsync. The same goes for refreshing an existing
+	// container as only rsync knows how to transfer just the differences.
+	if *header.Fs != *resp.Fs || c.refresh {
 		mySink = rsyncMigrationSink
 		myType = MigrationFSType_RSYNC
 		resp.Fs = &myType
 	}
 
+	// A compressed stream is always sent through rsync.
+	if c.compression != "" && *resp.Fs == MigrationFSType_RSYNC {
+		mySink = func(live bool, container container, snapshots []*Snapshot, conn *websocket.Conn, srcIdmap *shared.IdmapSet, op *operation, containerOnly bool) error {
+			return rsyncMigrationSinkCompressed(live, container, snapshots, conn, srcIdmap, op, containerOnly, c.compression)
+		}
+	}
+
+	// A source which knows about refreshes skips the snapshots we already
+	// have, so they're only listed when it said so
+	existing := []string{}
+	if c.refresh && header.GetRefresh() {
+		snaps, err := c.src.container.Snapshots()
+		if err != nil {
+			controller(err)
+			return err
+		}
+
+		for _, snap := range snaps {
+			existing = append(existing, shared.ExtractSnapshotName(snap.Name()))
+		}
+
+		resp.SnapshotNames = existing
+	}
+
 	err = sender(&resp)
 	if err != nil {
 		controller(err)
@@ -829,6 +1098,16 @@ func (c *migrationSink) Do(migrateOp *operation) error {
 				snapshots = header.Snapshots
 			}
 
+			if len(existing) > 0 {
+				missing := []*Snapshot{}
+				for _, snap := range snapshots {
+					if !shared.StringInSlice(snap.GetName(), existing) {
+						missing = append(missing, snap)
+					}
+				}
+				snapshots = missing
+			}
+
 			var fsConn *websocket.Conn
 			if c.push {
 				fsConn = c.dest.fsConn
@@ -868,7 +1147,7 @@ func (c *migrationSink) Do(migrateOp *operation) error {
 				criuConn = c.src.criuConn
 			}
 
-			err = RsyncRecv(shared.AddSlash(imagesDir), criuConn, nil)
+			err = RsyncRecv(shared.AddSlash(imagesDir), criuConn, nil, "")
 			if err != nil {
 				restore <- err
 				return
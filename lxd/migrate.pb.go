@@ -260,6 +260,7 @@ type MigrationHeader struct {
 	Idmap            []*IDMapType     `protobuf:"bytes,3,rep,name=idmap" json:"idmap,omitempty"`
 	SnapshotNames    []string         `protobuf:"bytes,4,rep,name=snapshotNames" json:"snapshotNames,omitempty"`
 	Snapshots        []*Snapshot      `protobuf:"bytes,5,rep,name=snapshots" json:"snapshots,omitempty"`
+	Refresh          *bool            `protobuf:"varint,6,opt,name=refresh" json:"refresh,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -302,6 +303,13 @@ func (m *MigrationHeader) GetSnapshots() []*Snapshot {
 	return nil
 }
 
+func (m *MigrationHeader) GetRefresh() bool {
+	if m != nil && m.Refresh != nil {
+		return *m.Refresh
+	}
+	return false
+}
+
 type MigrationControl struct {
 	Success *bool `protobuf:"varint,1,req,name=success" json:"success,omitempty"`
 	// optional failure message if sending a failure
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/lxc/lxd/shared"
+	"github.com/lxc/lxd/shared/api"
+)
+
+// storageVolumeMigrationSource sends a custom storage volume over rsync to
+// the destination connecting to its operation.
+type storageVolumeMigrationSource struct {
+	storage    storage
+	poolName   string
+	volumeName string
+
+	fsSecret     string
+	fsConn       *websocket.Conn
+	allConnected chan bool
+}
+
+func NewStorageVolumeMigrationSource(s storage, poolName string, volumeName string) (*storageVolumeMigrationSource, error) {
+	ret := storageVolumeMigrationSource{storage: s, poolName: poolName, volumeName: volumeName, allConnected: make(chan bool, 1)}
+
+	var err error
+	ret.fsSecret, err = shared.RandomCryptoString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (s *storageVolumeMigrationSource) Metadata() interface{} {
+	return shared.Jmap{"fs": s.fsSecret}
+}
+
+func (s *storageVolumeMigrationSource) Connect(op *operation, r *http.Request, w http.ResponseWriter) error {
+	secret := r.FormValue("secret")
+	if secret == "" {
+		return fmt.Errorf("missing secret")
+	}
+
+	// As with containers, a bad secret for an existing operation is a 403
+	if secret != s.fsSecret {
+		return os.ErrPermission
+	}
+
+	c, err := shared.WebsocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	s.fsConn = c
+	s.allConnected <- true
+
+	return nil
+}
+
+func (s *storageVolumeMigrationSource) Do(op *operation) error {
+	<-s.allConnected
+	defer s.fsConn.Close()
+
+	ourMount, err := s.storage.StoragePoolVolumeMount()
+	if err != nil {
+		return err
+	}
+	if ourMount {
+		defer s.storage.StoragePoolVolumeUmount()
+	}
+
+	path := shared.AddSlash(getStoragePoolVolumeMountPoint(s.poolName, s.volumeName))
+	wrapper := StorageProgressReader(op, "fs_progress", s.volumeName)
+
+	return RsyncSend(s.volumeName, path, s.fsConn, wrapper, "", false, "", nil)
+}
+
+// storageVolumeMigrationRecv connects to the migration source of a custom
+// storage volume and receives its content into the new volume.
+func storageVolumeMigrationRecv(op *operation, s storage, poolName string, volumeName string, source api.StorageVolumeSource) error {
+	var cert *x509.Certificate
+	if source.Certificate != "" {
+		certBlock, _ := pem.Decode([]byte(source.Certificate))
+		if certBlock == nil {
+			return fmt.Errorf("Invalid certificate")
+		}
+
+		var err error
+		cert, err = x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := shared.GetTLSConfig("", "", "", cert)
+	if err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig: config,
+		NetDial:         shared.RFC3493Dialer,
+	}
+
+	query := url.Values{"secret": []string{source.Websockets["fs"]}}
+
+	// The URL is a https URL to the operation, mangle to be a wss URL to the secret
+	wsUrl := fmt.Sprintf("wss://%s/websocket?%s", strings.TrimPrefix(source.Operation, "https://"), query.Encode())
+
+	conn, _, err := dialer.Dial(wsUrl, http.Header{})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ourMount, err := s.StoragePoolVolumeMount()
+	if err != nil {
+		return err
+	}
+	if ourMount {
+		defer s.StoragePoolVolumeUmount()
+	}
+
+	path := shared.AddSlash(getStoragePoolVolumeMountPoint(poolName, volumeName))
+	wrapper := StorageProgressWriter(op, "fs_progress", volumeName)
+
+	return RsyncRecv(path, conn, wrapper, "")
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"syscall"
 
 	"github.com/gorilla/websocket"
 	"github.com/pborman/uuid"
@@ -45,7 +46,21 @@ func rsyncLocalCopy(source string, dest string, bwlimit string) (string, error)
 		dest)
 }
 
-func rsyncSendSetup(name string, path string, bwlimit string) (*exec.Cmd, net.Conn, io.ReadCloser, error) {
+// rsyncCompressionArgs returns the rsync arguments selecting the given
+// stream compression. Both ends of the transfer must agree on them as the
+// receiving rsync is started with a fixed set of server arguments.
+func rsyncCompressionArgs(compression string) []string {
+	switch compression {
+	case "", "none":
+		return nil
+	case "gzip":
+		return []string{"--compress"}
+	default:
+		return []string{"--compress", fmt.Sprintf("--compress-choice=%s", compression)}
+	}
+}
+
+func rsyncSendSetup(name string, path string, bwlimit string, compression string, excludes []string) (*exec.Cmd, net.Conn, io.ReadCloser, error) {
 	/*
 	 * The way rsync works, it invokes a subprocess that does the actual
 	 * talking (given to it by a -E argument). Since there isn't an easy
@@ -87,7 +102,7 @@ func rsyncSendSetup(name string, path string, bwlimit string) (*exec.Cmd, net.Co
 		bwlimit = "0"
 	}
 
-	cmd := exec.Command("rsync",
+	args := []string{
 		"-arvP",
 		"--devices",
 		"--numeric-ids",
@@ -98,7 +113,13 @@ func rsyncSendSetup(name string, path string, bwlimit string) (*exec.Cmd, net.Co
 		"-e",
 		rsyncCmd,
 		"--bwlimit",
-		bwlimit)
+		bwlimit}
+	args = append(args, rsyncCompressionArgs(compression)...)
+	for _, exclude := range excludes {
+		args = append(args, "--exclude", exclude)
+	}
+
+	cmd := exec.Command("rsync", args...)
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -121,9 +142,11 @@ func rsyncSendSetup(name string, path string, bwlimit string) (*exec.Cmd, net.Co
 }
 
 // RsyncSend sets up the sending half of an rsync, to recursively send the
-// directory pointed to by path over the websocket.
-func RsyncSend(name string, path string, conn *websocket.Conn, readWrapper func(io.ReadCloser) io.ReadCloser, bwlimit string) error {
-	cmd, dataSocket, stderr, err := rsyncSendSetup(name, path, bwlimit)
+// directory pointed to by path over the websocket. With allowInconsistent,
+// files vanishing during the transfer aren't treated as a failure. The paths
+// matching the exclude patterns aren't sent.
+func RsyncSend(name string, path string, conn *websocket.Conn, readWrapper func(io.ReadCloser) io.ReadCloser, bwlimit string, allowInconsistent bool, compression string, excludes []string) error {
+	cmd, dataSocket, stderr, err := rsyncSendSetup(name, path, bwlimit, compression, excludes)
 	if err != nil {
 		return err
 	}
@@ -147,6 +170,11 @@ func RsyncSend(name string, path string, conn *websocket.Conn, readWrapper func(
 	}
 
 	err = cmd.Wait()
+	if err != nil && allowInconsistent && rsyncExitCode(err) == 24 {
+		logger.Warnf("Rsync send of %s had files vanishing during the transfer: %s", path, string(output))
+		err = nil
+	}
+
 	if err != nil {
 		logger.Errorf("Rsync send failed: %s: %s: %s", path, err, string(output))
 	}
@@ -157,19 +185,37 @@ func RsyncSend(name string, path string, conn *websocket.Conn, readWrapper func(
 	return err
 }
 
+// rsyncExitCode returns the exit code of a failed rsync, or -1 if it didn't
+// exit normally.
+func rsyncExitCode(err error) int {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return -1
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Exited() {
+		return -1
+	}
+
+	return status.ExitStatus()
+}
+
 // RsyncRecv sets up the receiving half of the websocket to rsync (the other
 // half set up by RsyncSend), putting the contents in the directory specified
-// by path.
-func RsyncRecv(path string, conn *websocket.Conn, writeWrapper func(io.WriteCloser) io.WriteCloser) error {
-	cmd := exec.Command("rsync",
+// by path. The compression must match the one used by the sender.
+func RsyncRecv(path string, conn *websocket.Conn, writeWrapper func(io.WriteCloser) io.WriteCloser, compression string) error {
+	args := []string{
 		"--server",
 		"-vlogDtpre.iLsfx",
 		"--numeric-ids",
 		"--devices",
 		"--partial",
-		"--sparse",
-		".",
-		path)
+		"--sparse"}
+	args = append(args, rsyncCompressionArgs(compression)...)
+	args = append(args, ".", path)
+
+	cmd := exec.Command("rsync", args...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
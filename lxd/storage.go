@@ -613,6 +613,19 @@ func progressWrapperRender(op *operation, key string, description string, progre
 		progress = fmt.Sprintf("%s: %s (%s/s)", description, shared.GetByteSizeString(progressInt, 2), shared.GetByteSizeString(speedInt, 2))
 	}
 
+	// Keep the byte count of every transfer so the total is known once the
+	// operation is done.
+	bytesKey := fmt.Sprintf("%s_bytes", key)
+	transferred, ok := meta[bytesKey].(map[string]int64)
+	if !ok {
+		transferred = map[string]int64{}
+	}
+
+	if progressInt > transferred[description] {
+		transferred[description] = progressInt
+	}
+	meta[bytesKey] = transferred
+
 	if meta[key] != progress {
 		meta[key] = progress
 		op.UpdateMetadata(meta)
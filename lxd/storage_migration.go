@@ -34,8 +34,11 @@ type MigrationStorageSourceDriver interface {
 }
 
 type rsyncStorageSourceDriver struct {
-	container container
-	snapshots []container
+	container         container
+	snapshots         []container
+	allowInconsistent bool
+	compression       string
+	excludes          []string
 }
 
 func (s rsyncStorageSourceDriver) Snapshots() []container {
@@ -57,7 +60,7 @@ func (s rsyncStorageSourceDriver) SendWhileRunning(conn *websocket.Conn, op *ope
 
 			path := send.Path()
 			wrapper := StorageProgressReader(op, "fs_progress", send.Name())
-			err = RsyncSend(ctName, shared.AddSlash(path), conn, wrapper, bwlimit)
+			err = RsyncSend(ctName, shared.AddSlash(path), conn, wrapper, bwlimit, s.allowInconsistent, s.compression, s.excludes)
 			if err != nil {
 				return err
 			}
@@ -65,13 +68,13 @@ func (s rsyncStorageSourceDriver) SendWhileRunning(conn *websocket.Conn, op *ope
 	}
 
 	wrapper := StorageProgressReader(op, "fs_progress", s.container.Name())
-	return RsyncSend(ctName, shared.AddSlash(s.container.Path()), conn, wrapper, bwlimit)
+	return RsyncSend(ctName, shared.AddSlash(s.container.Path()), conn, wrapper, bwlimit, s.allowInconsistent, s.compression, s.excludes)
 }
 
 func (s rsyncStorageSourceDriver) SendAfterCheckpoint(conn *websocket.Conn, bwlimit string) error {
 	ctName, _, _ := containerGetParentAndSnapshotName(s.container.Name())
 	// resync anything that changed between our first send and the checkpoint
-	return RsyncSend(ctName, shared.AddSlash(s.container.Path()), conn, nil, bwlimit)
+	return RsyncSend(ctName, shared.AddSlash(s.container.Path()), conn, nil, bwlimit, s.allowInconsistent, s.compression, s.excludes)
 }
 
 func (s rsyncStorageSourceDriver) Cleanup() {
@@ -88,7 +91,7 @@ func rsyncMigrationSource(c container, containerOnly bool) (MigrationStorageSour
 		}
 	}
 
-	return rsyncStorageSourceDriver{c, snapshots}, nil
+	return rsyncStorageSourceDriver{c, snapshots, false, "", nil}, nil
 }
 
 func snapshotProtobufToContainerArgs(containerName string, snap *Snapshot) containerArgs {
@@ -122,6 +125,12 @@ func snapshotProtobufToContainerArgs(containerName string, snap *Snapshot) conta
 }
 
 func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, conn *websocket.Conn, srcIdmap *shared.IdmapSet, op *operation, containerOnly bool) error {
+	return rsyncMigrationSinkCompressed(live, container, snapshots, conn, srcIdmap, op, containerOnly, "")
+}
+
+// rsyncMigrationSinkCompressed is rsyncMigrationSink for a sender using the
+// given rsync stream compression.
+func rsyncMigrationSinkCompressed(live bool, container container, snapshots []*Snapshot, conn *websocket.Conn, srcIdmap *shared.IdmapSet, op *operation, containerOnly bool, compression string) error {
 	ourStart, err := container.StorageStart()
 	if err != nil {
 		return err
@@ -162,13 +171,18 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 					}
 				}
 
-				s, err := containerCreateEmptySnapshot(container.Daemon(), args)
+				// Snapshots which already exist on a refreshed
+				// container are synced in place.
+				s, err := containerLoadByName(container.Daemon(), args.Name)
 				if err != nil {
-					return err
+					s, err = containerCreateEmptySnapshot(container.Daemon(), args)
+					if err != nil {
+						return err
+					}
 				}
 
 				wrapper := StorageProgressWriter(op, "fs_progress", s.Name())
-				if err := RsyncRecv(shared.AddSlash(s.Path()), conn, wrapper); err != nil {
+				if err := RsyncRecv(shared.AddSlash(s.Path()), conn, wrapper, compression); err != nil {
 					return err
 				}
 
@@ -180,7 +194,7 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 		}
 
 		wrapper := StorageProgressWriter(op, "fs_progress", container.Name())
-		err = RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper)
+		err = RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper, compression)
 		if err != nil {
 			return err
 		}
@@ -202,7 +216,7 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 				}
 
 				wrapper := StorageProgressWriter(op, "fs_progress", snap.GetName())
-				err := RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper)
+				err := RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper, compression)
 				if err != nil {
 					return err
 				}
@@ -212,6 +226,14 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 					return err
 				}
 
+				// Sources which don't know about refreshes still
+				// send the snapshots a refreshed container already
+				// has, those are kept as they are.
+				_, err = containerLoadByName(container.Daemon(), args.Name)
+				if err == nil {
+					continue
+				}
+
 				_, err = containerCreateAsSnapshot(container.Daemon(), args, container)
 				if err != nil {
 					return err
@@ -220,7 +242,7 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 		}
 
 		wrapper := StorageProgressWriter(op, "fs_progress", container.Name())
-		err = RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper)
+		err = RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper, compression)
 		if err != nil {
 			return err
 		}
@@ -229,7 +251,7 @@ func rsyncMigrationSink(live bool, container container, snapshots []*Snapshot, c
 	if live {
 		/* now receive the final sync */
 		wrapper := StorageProgressWriter(op, "fs_progress", container.Name())
-		err := RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper)
+		err := RsyncRecv(shared.AddSlash(container.Path()), conn, wrapper, compression)
 		if err != nil {
 			return err
 		}
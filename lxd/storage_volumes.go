@@ -162,6 +162,14 @@ func storagePoolVolumesTypePost(d *Daemon, r *http.Request) Response {
 	// volume is supposed to be created.
 	poolName := mux.Vars(r)["name"]
 
+	switch req.Source.Type {
+	case "":
+	case "migration":
+		return storagePoolVolumesTypeMigrationPost(d, poolName, req)
+	default:
+		return BadRequest(fmt.Errorf("unknown source type %s", req.Source.Type))
+	}
+
 	err = storagePoolVolumeCreateInternal(d, poolName, req.Name, req.Description, req.Type, req.Config)
 	if err != nil {
 		return InternalError(err)
@@ -175,6 +183,51 @@ func storagePoolVolumesTypePost(d *Daemon, r *http.Request) Response {
 	return SyncResponseLocation(true, nil, fmt.Sprintf("/%s/storage-pools/%s/volumes/%s", version.APIVersion, poolName, apiEndpoint))
 }
 
+// storagePoolVolumesTypeMigrationPost creates a custom storage volume and
+// pulls its content from a migration source on another LXD.
+func storagePoolVolumesTypeMigrationPost(d *Daemon, poolName string, req api.StorageVolumesPost) Response {
+	if req.Type != "custom" {
+		return BadRequest(fmt.Errorf("only custom storage volumes can be migrated"))
+	}
+
+	if req.Source.Mode != "" && req.Source.Mode != "pull" {
+		return NotImplemented
+	}
+
+	err := storagePoolVolumeCreateInternal(d, poolName, req.Name, req.Description, req.Type, req.Config)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	s, err := storagePoolVolumeInit(d, poolName, req.Name, storagePoolVolumeTypeCustom)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	run := func(op *operation) error {
+		err := storageVolumeMigrationRecv(op, s, poolName, req.Name, req.Source)
+		if err != nil {
+			// Don't leave a partial copy behind
+			poolID, _ := s.GetContainerPoolInfo()
+			s.StoragePoolVolumeDelete()
+			dbStoragePoolVolumeDelete(d.db, req.Name, storagePoolVolumeTypeCustom, poolID)
+			return fmt.Errorf("Error transferring storage volume data: %s", err)
+		}
+
+		return nil
+	}
+
+	resources := map[string][]string{}
+	resources["storage-pools"] = []string{fmt.Sprintf("%s/volumes/custom/%s", poolName, req.Name)}
+
+	op, err := operationCreate(operationClassTask, resources, nil, run, nil, nil)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	return OperationResponse(op)
+}
+
 var storagePoolVolumesTypeCmd = Command{name: "storage-pools/{name}/volumes/{type}", get: storagePoolVolumesTypeGet, post: storagePoolVolumesTypePost}
 
 // /1.0/storage-pools/{pool}/volumes/{type}/{name}
@@ -415,4 +468,68 @@ func storagePoolVolumeTypeDelete(d *Daemon, r *http.Request) Response {
 	return EmptySyncResponse
 }
 
-var storagePoolVolumeTypeCmd = Command{name: "storage-pools/{pool}/volumes/{type}/{name:.*}", get: storagePoolVolumeTypeGet, put: storagePoolVolumeTypePut, patch: storagePoolVolumeTypePatch, delete: storagePoolVolumeTypeDelete}
+// /1.0/storage-pools/{pool}/volumes/{type}/{name}
+// Set up the migration of a custom storage volume to another LXD.
+func storagePoolVolumeTypePost(d *Daemon, r *http.Request) Response {
+	// Get the name of the storage volume.
+	volumeName := mux.Vars(r)["name"]
+
+	// Get the name of the storage pool the volume is supposed to be
+	// attached to.
+	poolName := mux.Vars(r)["pool"]
+
+	// Get the name of the volume type.
+	volumeTypeName := mux.Vars(r)["type"]
+
+	// Convert the volume type name to our internal integer representation.
+	volumeType, err := storagePoolVolumeTypeNameToType(volumeTypeName)
+	if err != nil {
+		return BadRequest(err)
+	}
+
+	if volumeType != storagePoolVolumeTypeCustom {
+		return BadRequest(fmt.Errorf("storage volumes of type \"%s\" cannot be migrated with the storage api", volumeTypeName))
+	}
+
+	req := api.StorageVolumePost{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return BadRequest(err)
+	}
+
+	if !req.Migration {
+		return BadRequest(fmt.Errorf("renaming storage volumes isn't supported"))
+	}
+
+	poolID, err := dbStoragePoolGetID(d.db, poolName)
+	if err != nil {
+		return SmartError(err)
+	}
+
+	_, _, err = dbStoragePoolVolumeGetType(d.db, volumeName, volumeType, poolID)
+	if err != nil {
+		return SmartError(err)
+	}
+
+	s, err := storagePoolVolumeInit(d, poolName, volumeName, volumeType)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	ws, err := NewStorageVolumeMigrationSource(s, poolName, volumeName)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	resources := map[string][]string{}
+	resources["storage-pools"] = []string{fmt.Sprintf("%s/volumes/custom/%s", poolName, volumeName)}
+
+	op, err := operationCreate(operationClassWebsocket, resources, ws.Metadata(), ws.Do, nil, ws.Connect)
+	if err != nil {
+		return InternalError(err)
+	}
+
+	return OperationResponse(op)
+}
+
+var storagePoolVolumeTypeCmd = Command{name: "storage-pools/{pool}/volumes/{type}/{name:.*}", get: storagePoolVolumeTypeGet, put: storagePoolVolumeTypePut, post: storagePoolVolumeTypePost, patch: storagePoolVolumeTypePatch, delete: storagePoolVolumeTypeDelete}
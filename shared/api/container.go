@@ -10,6 +10,10 @@ type ContainersPost struct {
 
 	Name   string          `json:"name" yaml:"name"`
 	Source ContainerSource `json:"source" yaml:"source"`
+
+	// API extension: container_copy_timestamps
+	CreatedAt  time.Time `json:"created_at" yaml:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at" yaml:"last_used_at"`
 }
 
 // ContainerPost represents the fields required to rename/move a LXD container
@@ -25,6 +29,39 @@ type ContainerPost struct {
 
 	// API extension: container_only_migration
 	ContainerOnly bool `json:"container_only" yaml:"container_only"`
+
+	// API extension: container_migration_bwlimit
+	Bwlimit string `json:"bwlimit,omitempty" yaml:"bwlimit,omitempty"`
+
+	// API extension: container_copy_allow_inconsistent
+	AllowInconsistent bool `json:"allow_inconsistent" yaml:"allow_inconsistent"`
+
+	// API extension: container_migration_compression
+	Compression string `json:"compression,omitempty" yaml:"compression,omitempty"`
+
+	// API extension: container_push_target
+	Target *ContainerPostTarget `json:"target,omitempty" yaml:"target,omitempty"`
+
+	// API extension: container_migration_protocol
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+
+	// API extension: container_migration_snapshot_list
+	Snapshots []string `json:"snapshots,omitempty" yaml:"snapshots,omitempty"`
+
+	// API extension: container_migration_excludes
+	Excludes []string `json:"excludes,omitempty" yaml:"excludes,omitempty"`
+
+	// API extension: container_migration_refresh
+	Refresh bool `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+}
+
+// ContainerPostTarget represents the migration target host and operation
+//
+// API extension: container_push_target
+type ContainerPostTarget struct {
+	Certificate string            `json:"certificate" yaml:"certificate"`
+	Operation   string            `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Websockets  map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 }
 
 // ContainerPut represents the modifiable fields of a LXD container
@@ -104,4 +141,10 @@ type ContainerSource struct {
 
 	// API extension: container_only_migration
 	ContainerOnly bool `json:"container_only,omitempty" yaml:"container_only,omitempty"`
+
+	// API extension: container_incremental_copy
+	Refresh bool `json:"refresh,omitempty" yaml:"refresh,omitempty"`
+
+	// API extension: container_migration_compression
+	Compression string `json:"compression,omitempty" yaml:"compression,omitempty"`
 }
@@ -39,6 +39,28 @@ type StorageVolumesPost struct {
 
 	Name string `json:"name" yaml:"name"`
 	Type string `json:"type" yaml:"type"`
+
+	// API extension: storage_api_volume_rsync
+	Source StorageVolumeSource `json:"source" yaml:"source"`
+}
+
+// StorageVolumePost represents the fields required to migrate a LXD storage
+// volume
+//
+// API extension: storage_api_volume_rsync
+type StorageVolumePost struct {
+	Migration bool `json:"migration" yaml:"migration"`
+}
+
+// StorageVolumeSource represents the creation source for a new storage volume
+//
+// API extension: storage_api_volume_rsync
+type StorageVolumeSource struct {
+	Type        string            `json:"type" yaml:"type"`
+	Certificate string            `json:"certificate" yaml:"certificate"`
+	Mode        string            `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Operation   string            `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Websockets  map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 }
 
 // StorageVolume represents the fields of a LXD storage volume.
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ContainerAction string
@@ -96,6 +97,19 @@ var KnownContainerConfigKeys = map[string]func(value string) error{
 	"boot.autostart.priority":    IsInt64,
 	"boot.host_shutdown_timeout": IsInt64,
 
+	"expiry": func(value string) error {
+		if value == "" {
+			return nil
+		}
+
+		_, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("Invalid expiry date: %s", value)
+		}
+
+		return nil
+	},
+
 	"limits.cpu": IsAny,
 	"limits.cpu.allowance": func(value string) error {
 		if value == "" {
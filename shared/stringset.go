@@ -2,16 +2,27 @@
 // do it.
 package shared
 
+import (
+	"sort"
+)
+
 type StringSet map[string]bool
 
 func (ss StringSet) IsSubset(oss StringSet) bool {
+	return len(ss.Difference(oss)) == 0
+}
+
+// Difference returns the sorted elements of ss which aren't in oss
+func (ss StringSet) Difference(oss StringSet) []string {
+	diff := []string{}
 	for k := range map[string]bool(ss) {
 		if _, ok := map[string]bool(oss)[k]; !ok {
-			return false
+			diff = append(diff, k)
 		}
 	}
 
-	return true
+	sort.Strings(diff)
+	return diff
 }
 
 func NewStringSet(strings []string) StringSet {
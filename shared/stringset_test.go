@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -22,3 +23,25 @@ func TestStringSetSubset(t *testing.T) {
 		return
 	}
 }
+
+func TestStringSetDifference(t *testing.T) {
+	ss := NewStringSet([]string{"one", "two", "three"})
+
+	diff := ss.Difference(NewStringSet([]string{"two", "four"}))
+	if !reflect.DeepEqual(diff, []string{"one", "three"}) {
+		t.Errorf("difference wrong: %v", diff)
+		return
+	}
+
+	diff = ss.Difference(ss)
+	if len(diff) != 0 {
+		t.Errorf("difference wrong: %v", diff)
+		return
+	}
+
+	diff = NewStringSet(nil).Difference(ss)
+	if len(diff) != 0 {
+		t.Errorf("difference wrong: %v", diff)
+		return
+	}
+}
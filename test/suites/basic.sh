@@ -100,6 +100,23 @@ test_basic_usage() {
   lxc copy bar foo
   lxc delete foo
 
+  # Test container rebase
+  lxc copy bar foo
+  lxc config set foo user.foo bar
+  lxc snapshot foo
+  ! lxc rebase foo testimage
+  lxc info foo | grep -q snap0
+  lxc rebase foo testimage --yes
+  [ "$(lxc config get foo user.foo)" = "bar" ]
+  ! lxc info foo | grep -q snap0
+  ! lxc rebase foo nonexistent --yes
+  [ "$(lxc config get foo user.foo)" = "bar" ]
+  lxc rebase foo testimage --backup | grep -q "foo-backup-"
+  lxc delete "$(lxc list -c n --format csv | grep foo-backup-)"
+  lxc start foo
+  ! lxc rebase foo testimage --yes
+  lxc delete foo --force
+
   # gen untrusted cert
   gen_cert client3
 
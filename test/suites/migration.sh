@@ -105,8 +105,27 @@ migration() {
   if [ "$lxd2_backend" != "lvm" ]; then
     [ -d "${lxd2_dir}/containers/nonlive3/rootfs/bin" ]
   fi
+  [ "$(lxc_remote info l2:nonlive3 | grep -c snap)" -eq 0 ]
   lxc_remote delete l2:nonlive3 --force
 
+  # A snapshot copy ignores --container-only and has no snapshots
+  lxc_remote copy l1:nonlive2/snap0 l2:nonlive3 --container-only
+  [ "$(lxc_remote info l2:nonlive3 | grep -c snap)" -eq 0 ]
+  lxc_remote delete l2:nonlive3 --force
+
+  # A transfer which keeps progressing isn't idle
+  lxc_remote copy l1:nonlive2 l2:nonlive3 --timeout-idle 1m
+  lxc_remote delete l2:nonlive3 --force
+  ! lxc_remote copy l1:nonlive2 l2:nonlive3 --timeout-idle 1m --wait=false
+
+  lxc_remote copy l1:nonlive2/snap0 l1:nonlive3
+  [ "$(lxc_remote info l1:nonlive3 | grep -c snap)" -eq 0 ]
+  # FIXME: make this backend agnostic
+  if [ "$lxd_backend" = "dir" ]; then
+    [ -d "${LXD_DIR}/containers/nonlive3/rootfs/bin" ]
+  fi
+  lxc_remote delete l1:nonlive3 --force
+
   lxc_remote stop l2:nonlive
   lxc_remote copy l2:nonlive l2:nonlive2
   # should have the same base image tag
@@ -145,6 +164,337 @@ migration() {
   [ "$(lxc file pull udssr/blah -)" = "after" ]
   lxc delete udssr
 
+  # Local container copy keeping the source timestamps.
+  sleep 1
+  lxc copy cccp udssr --preserve-timestamps
+  [ "$(lxc info udssr | grep Created)" = "$(lxc info cccp | grep Created)" ]
+  lxc delete udssr
+
+  # Local container copy with an explicit local remote.
+  lxc copy local:cccp local:udssr
+  lxc info udssr
+  ! lxc copy local:cccp local:
+  lxc delete udssr
+
+  # Local container copy dry run.
+  lxc copy cccp udssr --dry-run -c user.foo=bar | grep -q "user.foo=bar"
+  ! lxc info udssr
+  ! lxc copy cccp udssr --dry-run -p nonexistent
+  lxc_remote copy l1:cccp l2:udssr --dry-run | grep -q "migration"
+  lxc_remote copy l1:cccp l2:udssr --dry-run --strict-arch | grep -q "migration"
+  ! lxc copy cccp udssr --target-project foo
+  ! lxc_remote copy l1:cccp l2:udssr --target-project foo
+  ! lxc copy cccp udssr --project foo
+  ! lxc_remote info l2:udssr
+
+  # Remote container copy with config keys removed, local copies can't
+  # remove any.
+  lxc config set cccp user.foo bar
+  lxc config set cccp user.prefix.a a
+  lxc config set cccp user.prefix.b b
+  ! lxc copy cccp udssr --unset user.foo
+  ! lxc info udssr
+  lxc_remote copy l1:cccp l2:udssr --unset user.foo --unset "user.prefix.*" --unset user.nonexistent
+  ! lxc_remote config show l2:udssr | grep -q "user.foo"
+  ! lxc_remote config show l2:udssr | grep -q "user.prefix"
+  lxc config unset cccp user.foo
+  lxc config unset cccp user.prefix.a
+  lxc config unset cccp user.prefix.b
+  lxc_remote delete l2:udssr
+
+  # Local container copy with a spec read from stdin.
+  printf "config:\n  user.foo: spec\n  user.bar: spec\n" | lxc copy cccp udssr --spec - -c user.bar=flag
+  [ "$(lxc config get udssr user.foo)" = "spec" ]
+  [ "$(lxc config get udssr user.bar)" = "flag" ]
+  lxc delete udssr
+  ! echo "config: [" | lxc copy cccp udssr --spec -
+
+  # Local container copy with the profiles of another container.
+  lxc profile create copyprofile
+  lxc init testimage sibling -p default -p copyprofile
+  lxc copy cccp udssr --profile-from sibling
+  lxc config show udssr | grep -q "copyprofile"
+  lxc delete udssr
+  ! lxc copy cccp udssr --profile-from nonexistent
+  ! lxc info udssr
+  lxc delete sibling
+  lxc profile delete copyprofile
+
+  # Local container copy with device overrides.
+  lxc copy cccp udssr --device "tmp,type=disk,source=/tmp,path=/mnt"
+  lxc config device show udssr | grep -q "/mnt"
+  lxc delete udssr
+  ! lxc copy cccp udssr --device "tmp"
+
+  # Copies of an ephemeral container are ephemeral, locally and remotely,
+  # unless --ephemeral=false is passed.
+  lxc init testimage ephemeral --ephemeral
+  lxc copy ephemeral udssr
+  lxc config show udssr | grep -q "ephemeral: true"
+  lxc delete udssr
+  lxc copy ephemeral udssr --ephemeral=false
+  lxc config show udssr | grep -q "ephemeral: false"
+  lxc delete udssr
+  lxc_remote copy l1:ephemeral l2:udssr
+  lxc_remote config show l2:udssr | grep -q "ephemeral: true"
+  lxc_remote delete l2:udssr
+  lxc_remote copy l1:ephemeral l2:udssr --ephemeral=false
+  lxc_remote config show l2:udssr | grep -q "ephemeral: false"
+  lxc_remote delete l2:udssr
+  lxc delete ephemeral
+
+  # Local container copy forcing the ephemeral flag either way.
+  lxc copy cccp udssr --ephemeral
+  lxc config show udssr | grep -q "ephemeral: true"
+  lxc copy udssr udssr2 --ephemeral=false
+  lxc config show udssr2 | grep -q "ephemeral: false"
+  lxc delete udssr udssr2
+
+  # Remote container copy of only the filesystem, local copies always get
+  # the config of the source.
+  lxc config set cccp user.foo bar
+  ! lxc copy cccp udssr --rootfs-only
+  ! lxc info udssr
+  lxc_remote copy l1:cccp l2:udssr --rootfs-only
+  ! lxc_remote config show l2:udssr | grep -q "user.foo"
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  lxc config unset cccp user.foo
+
+  # Batch of copies described in a file.
+  cat > "${TEST_DIR}/copy-batch.yaml" << EOF
+- source: cccp
+  dest: udssr
+  config:
+    user.foo: bar
+- source: cccp
+  dest: udssr2
+EOF
+  lxc copy --batch "${TEST_DIR}/copy-batch.yaml" | grep -q "udssr2"
+  [ "$(lxc config get udssr user.foo)" = "bar" ]
+  [ "$(lxc file pull udssr2/blah -)" = "after" ]
+  ! lxc copy --batch "${TEST_DIR}/copy-batch.yaml"
+  ! lxc copy cccp --batch "${TEST_DIR}/copy-batch.yaml"
+  lxc delete udssr udssr2
+  lxc copy --batch "${TEST_DIR}/copy-batch.yaml" --parallel 2
+  [ "$(lxc file pull udssr/blah -)" = "after" ]
+  [ "$(lxc file pull udssr2/blah -)" = "after" ]
+  ! lxc copy --batch "${TEST_DIR}/copy-batch.yaml" --parallel 0
+  lxc delete udssr udssr2
+  rm "${TEST_DIR}/copy-batch.yaml"
+
+  # Local copy of the latest or oldest snapshot of a container.
+  lxc copy cccp/@latest udssr
+  [ "$(lxc file pull udssr/blah -)" = "before" ]
+  [ "$(lxc info udssr | grep -c snap)" -eq 0 ]
+  lxc delete udssr
+  lxc copy cccp udssr --from-snapshot oldest
+  [ "$(lxc file pull udssr/blah -)" = "before" ]
+  lxc delete udssr
+  ! lxc copy cccp udssr --from-snapshot newest
+  ! lxc copy cccp/snap0 udssr --from-snapshot latest
+  ! lxc copy cccp/@newest udssr
+  lxc copy cccp udssr --source-snapshot-only
+  [ "$(lxc file pull udssr/blah -)" = "before" ]
+  [ "$(lxc info udssr | grep -c snap)" -eq 0 ]
+  lxc delete udssr
+  ! lxc copy cccp udssr --source-snapshot-only --from-snapshot oldest
+
+  # Local container copy matching the profiles regardless of case.
+  ! lxc copy cccp udssr --no-profiles -p DEFAULT
+  lxc copy cccp udssr --no-profiles -p DEFAULT --profiles-ignore-case
+  lxc config show udssr | grep -q "^- default"
+  lxc delete udssr
+
+  # Local container copy picking a free name.
+  lxc copy cccp udssr
+  lxc copy cccp udssr --auto-name 2>&1 | grep -q "udssr-1"
+  lxc copy cccp udssr --auto-name
+  lxc info udssr-2
+  lxc copy cccp cccp --auto-name
+  lxc delete udssr udssr-1 udssr-2 cccp-1
+  ! lxc copy cccp udssr --auto-name --refresh
+
+  # Local container copy with a target spec.
+  lxc copy cccp udssr --target-spec '{"instance_type": "c2-m4"}'
+  [ "$(lxc config get udssr limits.cpu)" = "2" ]
+  lxc delete udssr
+  lxc copy cccp udssr --target-spec '{"instance_type": "c2-m4"}' --instance-type c1-m1
+  [ "$(lxc config get udssr limits.cpu)" = "1" ]
+  lxc delete udssr
+  ! lxc copy cccp udssr --target-spec '{"pools": "default"}'
+  ! lxc copy cccp udssr --target-spec 'foo'
+
+  # Local container copy with some of the snapshots.
+  lxc copy cccp udssr --snapshot snap1
+  [ "$(lxc info udssr | grep -c snap)" -eq 1 ]
+  lxc info udssr | grep -q snap1
+  lxc delete udssr
+  ! lxc copy cccp udssr --snapshot nonexistent
+  ! lxc info udssr
+  ! lxc copy cccp udssr --snapshot snap0 --container-only
+
+  # Local container copy keeping its MAC address.
+  lxc config set cccp volatile.eth0.hwaddr 00:16:3e:00:00:42
+  lxc copy cccp udssr --config-preserve volatile.eth0.hwaddr
+  [ "$(lxc config get udssr volatile.eth0.hwaddr)" = "00:16:3e:00:00:42" ]
+  lxc delete udssr
+  lxc copy cccp udssr
+  [ "$(lxc config get udssr volatile.eth0.hwaddr)" != "00:16:3e:00:00:42" ]
+  lxc delete udssr
+  ! lxc copy cccp udssr --config-preserve user.
+  lxc copy cccp udssr --keep-volatile 2>&1 | grep -q "MAC"
+  [ "$(lxc config get udssr volatile.eth0.hwaddr)" = "00:16:3e:00:00:42" ]
+  lxc delete udssr
+  lxc config unset cccp volatile.eth0.hwaddr
+
+  # Copies to an unknown remote fail before connecting.
+  lxc copy cccp l3:udssr 2>&1 | grep -q "unknown remote: l3"
+
+  # Local container copy replacing an existing container.
+  lxc copy cccp udssr
+  ! lxc copy cccp udssr
+  lxc config set udssr user.replaced true
+  ! lxc copy cccp udssr --replace < /dev/null
+  [ "$(lxc config get udssr user.replaced)" = "true" ]
+  lxc copy cccp udssr --replace --yes
+  [ -z "$(lxc config get udssr user.replaced)" ]
+  lxc copy cccp udssr --replace --backup
+  lxc list -c n | grep -q "udssr-backup-"
+  lxc delete "$(lxc list -c n --format csv | grep udssr-backup-)"
+  ! lxc copy cccp udssr --backup
+  lxc delete udssr
+
+  # Local container copy which expires.
+  lxc copy cccp udssr --expiry 1h
+  [ -n "$(lxc config get udssr expiry)" ]
+  lxc copy udssr udssr2
+  [ -z "$(lxc config get udssr2 expiry)" ]
+  lxc delete udssr udssr2
+  ! lxc config set cccp expiry 2001-01-01T00:00:00Z
+  ! lxc profile set default expiry 2100-01-01T00:00:00Z
+  ! lxc copy cccp udssr --expiry 2001-01-01
+  ! lxc copy cccp udssr --expiry soon
+
+  # Local container copy with an idmap.
+  lxc copy cccp udssr --map-uid 1000:1000 --map-gid 1000-1001:1000-1001
+  lxc config get udssr raw.idmap | grep -q "^uid 1000 1000$"
+  lxc config get udssr raw.idmap | grep -q "^gid 1000-1001 1000-1001$"
+  lxc delete udssr
+  ! lxc copy cccp udssr --map-uid 1000-1001:1000
+  ! lxc copy cccp udssr --map-uid 1000:1000 -c security.privileged=true
+
+  # Local container copy with a new description.
+  lxc copy cccp udssr --description "a copy"
+  lxc config show udssr | grep -q "description: a copy"
+  lxc delete udssr
+
+  # Local container copy with extra config.
+  lxc copy cccp udssr -c user.foo=bar
+  [ "$(lxc config get udssr user.foo)" = "bar" ]
+  lxc delete udssr
+
+  # Stateful copies need a running container on another remote.
+  ! lxc copy cccp udssr --stateful
+  ! lxc_remote copy l1:cccp l2:udssr --stateful
+
+  # Local container copy without the source profiles.
+  lxc copy cccp udssr --no-profiles --storage "lxdtest-$(basename "${LXD_DIR}")"
+  lxc config show udssr | grep -q "^profiles: \[\]"
+  lxc delete udssr
+
+  # Local container copy with a profile before the source ones.
+  lxc profile create prepended
+  lxc copy cccp udssr --profile-prepend prepended
+  [ "$(lxc config show udssr | grep -A1 "^profiles:" | tail -n1)" = "- prepended" ]
+  lxc delete udssr
+  lxc profile delete prepended
+
+  # Local container copy with a missing profile.
+  ! lxc copy cccp udssr -p nonexistent
+  lxc copy cccp udssr -p nonexistent 2>&1 | grep -q "nonexistent"
+  ! lxc info udssr
+
+  # Export of a container to a tarball.
+  lxc copy cccp/snap0 --to-file "${TEST_DIR}/cccp.tar.gz"
+  lxc image import "${TEST_DIR}/cccp.tar.gz" --alias cccp-export
+  lxc image delete cccp-export
+  rm "${TEST_DIR}/cccp.tar.gz"
+
+  # Container created from an exported tarball.
+  lxc copy cccp/snap0 --to-file "${TEST_DIR}/cccp.tar.gz"
+  lxc_remote copy --from-file "${TEST_DIR}/cccp.tar.gz" l2:udssr
+  lxc_remote info l2:udssr
+  lxc_remote delete l2:udssr
+  rm "${TEST_DIR}/cccp.tar.gz"
+  echo "not a tarball" > "${TEST_DIR}/cccp.tar.gz"
+  ! lxc copy --from-file "${TEST_DIR}/cccp.tar.gz" udssr
+  rm "${TEST_DIR}/cccp.tar.gz"
+  ! lxc copy cccp udssr --to-file "${TEST_DIR}/cccp.tar.gz"
+
+  # Local container copy started once copied.
+  lxc copy cccp udssr --start | grep -q "Started: true"
+  lxc info udssr | grep -q "Status: Running"
+  lxc delete udssr --force
+  ! lxc copy cccp udssr --start --wait=false
+
+  # Local container copy printing nothing.
+  [ -z "$(lxc copy cccp udssr --quiet --format json)" ]
+  lxc info udssr
+  lxc delete udssr
+  ! lxc copy cccp udssr --quiet --dry-run
+
+  # Local container copy with machine-readable output.
+  lxc copy cccp udssr --format json | grep -q '"container":"udssr"'
+  ! lxc copy cccp udssr2 --format yaml
+  lxc delete udssr
+
+  # Local container copy with content verification.
+  lxc copy cccp udssr --verify
+  [ "$(lxc file pull udssr/blah -)" = "after" ]
+  lxc delete udssr
+  ! lxc copy cccp/snap0 udssr --verify
+
+  # Local container copy with renamed snapshots.
+  lxc copy cccp udssr --snapshot-rename "old-{name}"
+  lxc info udssr | grep -q "old-snap0"
+  lxc info udssr | grep -q "old-snap1"
+  ! lxc info udssr | grep -q " snap0"
+  lxc delete udssr
+  ! lxc copy cccp udssr --snapshot-rename "{date}"
+  ! lxc info udssr
+
+  # Local container copy reporting how long it took.
+  lxc copy cccp udssr | grep -q "Copied in"
+  lxc delete udssr
+  lxc copy cccp udssr --format json | grep -q '"duration":'
+  lxc delete udssr
+
+  # Local container copy reporting its operation.
+  lxc copy cccp udssr --format json | grep -q '"operation":"/1.0/operations/'
+  lxc delete udssr
+  lxc copy cccp udssr --verbose 2>&1 | grep -q "operation /1.0/operations/"
+  lxc delete udssr
+
+  # Local container copy printing the bare name of the new container.
+  [ "$(lxc copy cccp udssr --print-name)" = "udssr" ]
+  lxc delete udssr
+
+  # Local container copy with config from a file.
+  printf "user.foo: file\nuser.bar: file\n" > "${TEST_DIR}/copy-config.yaml"
+  lxc copy cccp udssr --config-from-file "${TEST_DIR}/copy-config.yaml" -c user.bar=flag
+  [ "$(lxc config get udssr user.foo)" = "file" ]
+  [ "$(lxc config get udssr user.bar)" = "flag" ]
+  ! lxc copy cccp udssr2 --config-from-file "${TEST_DIR}/nonexistent.yaml"
+  rm "${TEST_DIR}/copy-config.yaml"
+  lxc delete udssr
+
+  # Local container copy to a specific storage pool.
+  lxc copy cccp udssr --storage "lxdtest-$(basename "${LXD_DIR}")"
+  lxc config show udssr | grep -q "pool: lxdtest-$(basename "${LXD_DIR}")"
+  ! lxc copy cccp udssr2 --storage nonexistent
+  lxc delete udssr
+
   # Remote container only copy.
   lxc_remote copy l1:cccp l2:udssr --container-only
   [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 0 ]
@@ -157,6 +507,212 @@ migration() {
   [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
   lxc_remote delete l2:udssr
 
+  # Remote container copy keeping the source timestamps.
+  lxc_remote copy l1:cccp l2:udssr --preserve-timestamps
+  [ "$(lxc_remote info l2:udssr | grep Created)" = "$(lxc_remote info l1:cccp | grep Created)" ]
+  lxc_remote delete l2:udssr
+
+  # Remote container copy with a rate limit.
+  lxc_remote copy l1:cccp l2:udssr --limit 50MB | grep -q "Transferred"
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --limit 50
+  ! lxc_remote copy l1:cccp l2:udssr --limit fast
+  ! lxc copy cccp udssr --limit 50MB
+
+  # Remote container copy tolerating inconsistencies.
+  lxc_remote copy l1:cccp l2:udssr --allow-inconsistent
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc copy cccp udssr --allow-inconsistent
+  ! lxc_remote copy l1:cccp/snap0 l2:udssr --allow-inconsistent
+
+  # Remote container copy between unix sockets given inline.
+  lxc_remote copy "unix://${LXD_DIR}/unix.socket:cccp" "unix://${lxd2_dir}/unix.socket:udssr"
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+
+  # Remote container copy dropping the profiles missing on the destination.
+  lxc_remote profile create l1:copyprofile
+  ! lxc_remote copy l1:cccp l2:udssr -p copyprofile
+  lxc_remote copy l1:cccp l2:udssr -p copyprofile --ignore-missing-profiles
+  ! lxc_remote config show l2:udssr | grep -q "copyprofile"
+  lxc_remote delete l2:udssr
+  lxc_remote profile delete l1:copyprofile
+
+  # Remote container copy published as an image.
+  lxc_remote copy l1:cccp l2:udssr --to-image --alias copiedimage | grep -q "fingerprint"
+  lxc_remote image info l2:copiedimage
+  ! lxc_remote info l2:udssr
+  lxc_remote image delete l2:copiedimage
+  ! lxc copy cccp udssr --alias copiedimage
+
+  # Remote container copy returning before the transfer completed.
+  wait_for "$(cat "${lxd2_dir}/lxd.addr")" lxc_remote copy l1:cccp l2:udssr --wait=false --format json
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --wait=false --mode=relay
+
+  # Remote container copy with a client certificate given on the command line.
+  lxc_remote copy l1:cccp l2:udssr --cert "${LXD_CONF}/client.crt" --key "${LXD_CONF}/client.key"
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --cert "${LXD_CONF}/client.crt"
+  ! lxc_remote copy l1:cccp l2:udssr --cert /nonexistent --key /nonexistent
+
+  # Failed copies exit with a code depending on what went wrong.
+  ret=0
+  lxc_remote copy l1:cccp l2:udssr -p nonexistent || ret=$?
+  [ "${ret}" = "2" ]
+  ! lxc_remote info l2:udssr
+
+  # Remote container copy running hooks, which need running containers.
+  lxc_remote launch testimage l1:hooked
+  lxc_remote copy l1:hooked l2:hooked --pre-hook "echo pre > /root/pre"
+  [ "$(lxc_remote file pull l1:hooked/root/pre -)" = "pre" ]
+  lxc_remote copy l1:hooked l2:hooked2 --post-hook "echo post > /root/post"
+  [ "$(lxc_remote file pull l2:hooked2/root/post -)" = "post" ]
+  lxc_remote info l2:hooked2 | grep -q "Status: Running"
+  ret=0
+  lxc_remote copy l1:hooked l2:hooked4 --post-hook "false" || ret=$?
+  [ "${ret}" = "5" ]
+  lxc_remote info l2:hooked4
+  ret=0
+  lxc_remote copy l1:hooked l2:hooked3 --pre-hook "false" || ret=$?
+  [ "${ret}" = "5" ]
+  ! lxc_remote info l2:hooked3
+  lxc_remote delete --force l2:hooked l2:hooked2 l2:hooked4
+  lxc_remote delete --force l1:hooked
+
+  # Remote container copy keeping failed transfers never touches an
+  # existing container.
+  lxc_remote copy l1:cccp l2:udssr
+  echo "untouched" | lxc_remote file push - l2:udssr/blah
+  ! lxc_remote copy l1:cccp l2:udssr --keep-on-fail
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "untouched" ]
+  lxc_remote delete l2:udssr
+
+  # Remote container copy with a compressed transfer.
+  lxc_remote copy l1:cccp l2:udssr --compression gzip
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  lxc_remote copy l1:cccp l2:udssr --compression none
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --compression foo
+  ! lxc copy cccp udssr --compression gzip
+
+  # Remote container copy along with its custom storage volume, which goes to
+  # the pool of the same name.
+  lxc_remote storage create l1:volcopy dir
+  lxc_remote storage create l2:volcopy dir
+  lxc_remote storage volume create l1:volcopy vol1
+  lxc_remote storage volume attach l1:volcopy vol1 cccp data /data
+  lxc_remote copy l1:cccp l2:udssr 2>&1 | grep -q "won't be copied"
+  ! lxc_remote storage volume show l2:volcopy vol1
+  lxc_remote delete l2:udssr
+  lxc_remote copy l1:cccp l2:udssr --with-volumes
+  lxc_remote storage volume show l2:volcopy vol1
+  lxc_remote config device get l2:udssr data source | grep -q vol1
+  ! lxc_remote copy l1:cccp l2:udssr2 --with-volumes
+  lxc_remote delete l2:udssr
+  lxc_remote storage volume delete l2:volcopy vol1
+  lxc_remote config device remove l1:cccp data
+  lxc_remote storage volume delete l1:volcopy vol1
+  lxc_remote storage delete l1:volcopy
+  lxc_remote storage delete l2:volcopy
+
+  # Remote container copy with some of the snapshots.
+  lxc_remote copy l1:cccp l2:udssr --snapshot snap0
+  [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 1 ]
+  lxc_remote info l2:udssr | grep -q snap0
+  lxc_remote delete l2:udssr
+
+  # Remote container copy following the server events.
+  lxc_remote copy l1:cccp l2:udssr --follow-events
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --follow-events --wait=false
+
+  # Remote container copy with a forced transfer protocol.
+  lxc_remote copy l1:cccp l2:udssr --protocol rsync
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --protocol foo
+  ! lxc_remote copy l1:cccp l2:udssr --protocol zfs --compression gzip
+  ! lxc copy cccp udssr --protocol rsync
+  if [ "$lxd_backend" = "dir" ]; then
+    ! lxc_remote copy l1:cccp l2:udssr --protocol btrfs
+  fi
+
+  # A failed copy never deletes an existing destination container.
+  lxc_remote copy l1:cccp l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr
+  lxc_remote info l2:udssr
+  lxc_remote delete l2:udssr
+
+  # Copy between two remotes pointing to the same server.
+  lxc_remote copy local:cccp l1:udssr --same-host-optimize 2>&1 | grep -q "same server"
+  [ "$(lxc_remote file pull l1:udssr/blah -)" = "after" ]
+  lxc_remote delete l1:udssr
+  lxc_remote copy l1:cccp l2:udssr --same-host-optimize 2>&1 | grep -q "different servers"
+  lxc_remote delete l2:udssr
+  lxc_remote copy local:cccp l1:cccp 2>&1 | grep -q "same server"
+  lxc_remote info l1:cccp
+
+  # Remote container copy relayed through the client.
+  lxc_remote copy l1:cccp l2:udssr --mode=relay
+  [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 2 ]
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp l2:udssr --mode=invalid
+
+  # Remote container copy pushed by the source.
+  lxc_remote copy l1:cccp l2:udssr --mode=push
+  [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 2 ]
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "after" ]
+  lxc_remote delete l2:udssr
+  ! lxc_remote copy l1:cccp/snap0 l2:udssr --mode=push
+
+  # Remote container refresh.
+  lxc_remote copy l1:cccp l2:udssr
+  echo "refreshed" | lxc_remote file push - l1:cccp/blah
+  ! lxc_remote copy l1:cccp l2:udssr
+  lxc_remote copy l1:cccp l2:udssr --refresh
+  [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 2 ]
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "refreshed" ]
+  ! lxc_remote copy l1:cccp l2:udssr --refresh --ephemeral
+  # Only the new snapshot is sent when refreshing.
+  lxc_remote snapshot l1:cccp refreshsnap
+  lxc_remote copy l1:cccp l2:udssr --refresh
+  [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 3 ]
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "refreshed" ]
+  lxc_remote delete l1:cccp/refreshsnap
+  echo "after" | lxc_remote file push - l1:cccp/blah
+  lxc_remote copy l1:cccp l2:udssr --refresh --exclude /blah
+  [ "$(lxc_remote file pull l2:udssr/blah -)" = "refreshed" ]
+  ! lxc_remote copy l1:cccp l2:udssr2 --exclude /blah
+  ! lxc copy cccp udssr --refresh --exclude /blah
+  lxc_remote delete l2:udssr
+
+  # Multiple remote containers copy.
+  lxc_remote copy l1:cccp l1:cccp2
+  lxc_remote copy l1:cccp l1:cccp2 l2:
+  lxc_remote info l2:cccp
+  lxc_remote info l2:cccp2
+  lxc_remote delete l2:cccp l2:cccp2 l1:cccp2
+  ! lxc_remote copy l1:nonexistent l1:cccp l2:
+  lxc_remote info l2:cccp
+  lxc_remote delete l2:cccp
+
+  # Remote copy of the containers matching a glob pattern.
+  lxc_remote copy l1:cccp l1:cccp2
+  lxc_remote copy 'l1:cccp*' l2: 2>&1 | grep -q "2 containers match"
+  lxc_remote info l2:cccp
+  lxc_remote info l2:cccp2
+  lxc_remote delete l2:cccp l2:cccp2 l1:cccp2
+  ! lxc_remote copy 'l1:nomatch*' l2:
+  ! lxc_remote copy 'l1:cccp*' l2:cccp3
+
   # Remote container only move.
   lxc_remote move l1:cccp l2:udssr --container-only
   ! lxc_remote info l1:cccp
@@ -173,6 +729,17 @@ migration() {
   [ "$(lxc_remote info l2:udssr | grep -c snap)" -eq 2 ]
   lxc_remote delete l2:udssr
 
+  # Remote container stateless move, a failed move keeps the source.
+  lxc_remote init testimage l1:cccp
+  lxc_remote init testimage l2:udssr
+  ! lxc_remote move l1:cccp l2:udssr
+  lxc_remote info l1:cccp
+  lxc_remote delete l2:udssr
+  lxc_remote move l1:cccp l2:udssr --stateful=false
+  ! lxc_remote info l1:cccp
+  lxc_remote info l2:udssr
+  lxc_remote delete l2:udssr
+
   # Test container only copies
   lxc init testimage cccp
   lxc snapshot cccp
@@ -215,6 +782,10 @@ migration() {
   # let the container do some interesting things
   sleep 1s
 
+  # Stateful copy reporting that the state was transferred.
+  lxc_remote copy l1:migratee l2:migratee --stateful --format json | grep -q '"stateful":true'
+  lxc_remote delete --force l2:migratee
+
   lxc_remote stop --stateful l1:migratee
   lxc_remote start l1:migratee
   lxc_remote delete --force l1:migratee